@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+// jobConfig holds a traverse job loaded from a YAML file given with --config.
+// Every key of the file is the name of a flag, flags given on the command line win over the file.
+type jobConfig struct {
+	// Values of the flags taking a path to a file, when the file declares them inline
+	relationshipRules    []parser.RelationshipRule
+	virtualRelationships []parser.VirtualRelationship
+	rowFilters           map[string]string
+	maskingRules         []parser.MaskingRule
+}
+
+// Checks of values which are only parsed once the command runs, so that
+// errors of the file point at the key rather than at the flag
+var jobConfigValidators = map[string]func(string) error{
+	"format": func(s string) error {
+		_, err := parser.ParseOutputFormat(s)
+		return err
+	},
+	"on-conflict": func(s string) error {
+		_, err := parser.ParseConflictMode(s)
+		return err
+	},
+	"remap-keys": func(s string) error {
+		_, err := parser.ParseKeyRemapMode(s)
+		return err
+	},
+}
+
+// load reads the file given with --config and sets every flag which wasn't given on the command line.
+// ctx: The context of the command.
+// c: The command holding the config flag.
+func (j *jobConfig) load(ctx context.Context, c *cli.Command) (context.Context, error) {
+	path := c.String("config")
+	if path == "" {
+		return ctx, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return ctx, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return ctx, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return ctx, fmt.Errorf("%s:%d: config file must be a mapping of flag names to values", path, root.Line)
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if err := j.apply(c, key.Value, value); err != nil {
+			return ctx, fmt.Errorf("%s:%d: invalid key %q: %v", path, key.Line, key.Value, err)
+		}
+	}
+
+	return ctx, nil
+}
+
+// apply sets the flag of the given name to the value of the file, unless it was given on the command line.
+func (j *jobConfig) apply(c *cli.Command, name string, value *yaml.Node) error {
+	flag := findFlag(c, name)
+	if flag == nil || name == "config" {
+		return fmt.Errorf("no such option")
+	}
+
+	if name == "relationship-rules" && value.Kind == yaml.SequenceNode {
+		var rules []parser.RelationshipRule
+		if err := value.Decode(&rules); err != nil {
+			return err
+		}
+		for i, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		}
+		j.relationshipRules = rules
+		return nil
+	}
+	if name == "virtual-relationships" && value.Kind == yaml.SequenceNode {
+		var relationships []parser.VirtualRelationship
+		if err := value.Decode(&relationships); err != nil {
+			return err
+		}
+		for i, v := range relationships {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("relationship %d: %v", i+1, err)
+			}
+		}
+		j.virtualRelationships = relationships
+		return nil
+	}
+	if name == "masking-rules" && value.Kind == yaml.SequenceNode {
+		var rules []parser.MaskingRule
+		if err := value.Decode(&rules); err != nil {
+			return err
+		}
+		for i, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		}
+		j.maskingRules = rules
+		return nil
+	}
+	if name == "row-filters" && value.Kind == yaml.MappingNode {
+		var filters map[string]string
+		if err := value.Decode(&filters); err != nil {
+			return err
+		}
+		if err := parser.ValidateRowFilters(filters); err != nil {
+			return err
+		}
+		j.rowFilters = filters
+		return nil
+	}
+
+	if c.IsSet(name) {
+		return nil
+	}
+
+	var values []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		if value.Tag == "!!null" {
+			return nil
+		}
+		values = []string{value.Value}
+	case yaml.SequenceNode:
+		if _, ok := flag.(*cli.StringSliceFlag); !ok {
+			return fmt.Errorf("expected a single value, not a list")
+		}
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("expected a list of values")
+			}
+			values = append(values, item.Value)
+		}
+	default:
+		return fmt.Errorf("expected a value or a list of values")
+	}
+
+	for _, v := range values {
+		if validate, ok := jobConfigValidators[name]; ok {
+			if err := validate(v); err != nil {
+				return err
+			}
+		}
+		if err := c.Set(name, v); err != nil {
+			return fmt.Errorf("invalid value %q: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// findFlag returns the flag of the command with the given name.
+func findFlag(c *cli.Command, name string) cli.Flag {
+	for _, flag := range c.Flags {
+		for _, n := range flag.Names() {
+			if n == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v3"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+// runJob runs a traverse command loading the given job file, the command and job config
+// are returned as they were when the action ran.
+func runJob(t *testing.T, config string, args ...string) (*cli.Command, *jobConfig, error) {
+	path := filepath.Join(t.TempDir(), "job.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatalf("failed to write job file: %v", err)
+	}
+
+	var job jobConfig
+	var ran *cli.Command
+	cmd := &cli.Command{
+		Name:   "traverse",
+		Before: job.load,
+		Flags:  traverseCommand().Flags,
+		Action: func(ctx context.Context, c *cli.Command) error {
+			ran = c
+			return nil
+		},
+	}
+	err := cmd.Run(context.Background(), append([]string{"traverse", "--config", path}, args...))
+	return ran, &job, err
+}
+
+func TestJobConfig(t *testing.T) {
+	t.Run("should set flags from the file", func(t *testing.T) {
+		c, _, err := runJob(t, `
+table: orders
+primary-key-values: [1, 2]
+excluded-tables:
+  - sessions
+  - audit_log
+max-depth: 3
+follow-children: false
+format: json
+output:
+`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "orders", c.String("table"))
+			assert.Equal(t, []string{"1", "2"}, c.StringSlice("primary-key-values"))
+			assert.Equal(t, []string{"sessions", "audit_log"}, c.StringSlice("excluded-tables"))
+			assert.Equal(t, int64(3), c.Int("max-depth"))
+			assert.False(t, c.Bool("follow-children"))
+			assert.Equal(t, "json", c.String("format"))
+			assert.Equal(t, "", c.String("output"))
+		}
+	})
+
+	t.Run("should prefer flags given on the command line", func(t *testing.T) {
+		c, _, err := runJob(t, `
+table: orders
+max-depth: 3
+format: json
+`, "--max-depth", "5", "--table", "users")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "users", c.String("table"))
+			assert.Equal(t, int64(5), c.Int("max-depth"))
+			assert.Equal(t, "json", c.String("format"))
+		}
+	})
+
+	t.Run("should report unknown keys with their line", func(t *testing.T) {
+		_, _, err := runJob(t, "table: orders\nmax-dept: 3\n")
+		assert.ErrorContains(t, err, `job.yaml:2: invalid key "max-dept": no such option`)
+
+		_, _, err = runJob(t, "table: orders\nconfig: other.yaml\n")
+		assert.ErrorContains(t, err, `job.yaml:2: invalid key "config": no such option`)
+	})
+
+	t.Run("should report invalid values with their line", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			config   string
+			expected string
+		}{
+			{
+				name:     "unknown format",
+				config:   "table: orders\n\nformat: xml\n",
+				expected: `job.yaml:3: invalid key "format": unknown output format "xml"`,
+			},
+			{
+				name:     "unknown conflict mode",
+				config:   "table: orders\non-conflict: replace\n",
+				expected: `job.yaml:2: invalid key "on-conflict"`,
+			},
+			{
+				name:     "unknown key remap mode",
+				config:   "table: orders\nremap-keys: shuffle\n",
+				expected: `job.yaml:2: invalid key "remap-keys"`,
+			},
+			{
+				name:     "not a number",
+				config:   "table: orders\nmax-depth: deep\n",
+				expected: `job.yaml:2: invalid key "max-depth": invalid value "deep"`,
+			},
+			{
+				name:     "list of a single value flag",
+				config:   "table: [orders, users]\n",
+				expected: `job.yaml:1: invalid key "table": expected a single value, not a list`,
+			},
+			{
+				name:     "invalid inline rule",
+				config:   "table: orders\nrelationship-rules:\n  - match: orders\n",
+				expected: `job.yaml:2: invalid key "relationship-rules": rule 1:`,
+			},
+			{
+				name:     "not a mapping",
+				config:   "- table\n",
+				expected: `config file must be a mapping of flag names to values`,
+			},
+		}
+
+		for _, c := range cases {
+			_, _, err := runJob(t, c.config)
+			assert.ErrorContains(t, err, c.expected, "unexpected error for case %s", c.name)
+		}
+	})
+
+	t.Run("should load inline rules, filters and relationships", func(t *testing.T) {
+		_, job, err := runJob(t, `
+table: orders
+relationship-rules:
+  - match: audit_log.user_id -> users
+    children: false
+virtual-relationships:
+  - source_table: comments
+    source_columns: [post_id]
+    target_table: posts
+    target_columns: [id]
+row-filters:
+  orders: status <> 'cancelled'
+masking-rules:
+  - column: users.email
+    strategy: email
+`)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		if assert.Len(t, job.relationshipRules, 1) {
+			assert.Equal(t, "audit_log.user_id -> users", job.relationshipRules[0].Match)
+			if assert.NotNil(t, job.relationshipRules[0].Children) {
+				assert.False(t, *job.relationshipRules[0].Children)
+			}
+		}
+		assert.Equal(t, []parser.VirtualRelationship{{
+			SourceTable:   "comments",
+			SourceColumns: []string{"post_id"},
+			TargetTable:   "posts",
+			TargetColumns: []string{"id"},
+		}}, job.virtualRelationships)
+		assert.Equal(t, map[string]string{"orders": "status <> 'cancelled'"}, job.rowFilters)
+		if assert.Len(t, job.maskingRules, 1) {
+			assert.Equal(t, "users.email", job.maskingRules[0].Column)
+			assert.Equal(t, parser.MaskEmail, job.maskingRules[0].Strategy)
+		}
+	})
+}
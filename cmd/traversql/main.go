@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -15,31 +16,77 @@ import (
 	"github.com/desprit-media/traversql-core/internal/parser"
 )
 
-// createPK constructs a parser.PrimaryKey from the provided primary key fields and values.
+// createPKs constructs parser.PrimaryKey values from the provided primary key fields and values.
+// Values are consumed in groups of the number of fields, one group per primary key.
 // It attempts to convert values to integers if possible.
 // pkFields: Slice of primary key field names.
 // pkValues: Slice of primary key values (as strings).
-func createPK(pkFields []string, pkValues []string) (parser.PrimaryKey, error) {
-	columns := make([]parser.Column, len(pkFields))
-	for i, pkField := range pkFields {
-		columns[i] = parser.Column{Name: pkField}
-	}
-	values := make([]interface{}, len(pkFields))
-	for i, pkValue := range pkValues {
-		pkValueInt, err := strconv.Atoi(pkValue)
+func createPKs(pkFields []string, pkValues []string) ([]parser.PrimaryKey, error) {
+	if len(pkFields) == 0 || len(pkValues) == 0 || len(pkValues)%len(pkFields) != 0 {
+		return nil, fmt.Errorf("expected %d primary key values per record, got %d values", len(pkFields), len(pkValues))
+	}
+
+	var pks []parser.PrimaryKey
+	for start := 0; start < len(pkValues); start += len(pkFields) {
+		columns := make([]parser.Column, len(pkFields))
+		for i, pkField := range pkFields {
+			columns[i] = parser.Column{Name: pkField}
+		}
+		values := make([]interface{}, len(pkFields))
+		for i, pkValue := range pkValues[start : start+len(pkFields)] {
+			pkValueInt, err := strconv.Atoi(pkValue)
+			if err != nil {
+				values[i] = pkValue
+			} else {
+				values[i] = pkValueInt
+			}
+		}
+
+		pk, err := parser.NewPrimaryKey(columns, values)
 		if err != nil {
-			values[i] = pkValue
-		} else {
-			values[i] = pkValueInt
+			return nil, fmt.Errorf("failed to create primary key: %v", err)
 		}
+		pks = append(pks, pk)
 	}
 
-	pk, err := parser.NewPrimaryKey(columns, values)
-	if err != nil {
-		return parser.PrimaryKey{}, fmt.Errorf("failed to create primary key: %v", err)
+	return pks, nil
+}
+
+// entryKeys returns primary keys of the records to start traversing from, given either
+// as primary key values or selected by a --where predicate or a --query.
+// ctx: The context of the command.
+// c: The command holding flags created by traversalFlags.
+// p: The parser of the source database.
+func entryKeys(ctx context.Context, c *cli.Command, p *parser.Parser) ([]parser.PrimaryKey, error) {
+	table := parser.Table{Name: c.String("table"), Schema: c.String("schema")}
+
+	given := 0
+	for _, name := range []string{"primary-key-values", "where", "query"} {
+		if c.IsSet(name) {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, fmt.Errorf("exactly one of --primary-key-values, --where or --query is required")
 	}
 
-	return pk, nil
+	var pks []parser.PrimaryKey
+	var err error
+	switch {
+	case c.IsSet("where"):
+		pks, err = p.SelectEntryKeys(ctx, table, c.String("where"))
+	case c.IsSet("query"):
+		pks, err = p.QueryEntryKeys(ctx, table, c.String("query"))
+	default:
+		return createPKs(c.StringSlice("primary-key-fields"), c.StringSlice("primary-key-values"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select entry records: %v", err)
+	}
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("no records of table %s matched", table.FullName())
+	}
+	return pks, nil
 }
 
 // createPgPool initializes a new PostgreSQL connection pool using configuration from environment variables.
@@ -57,6 +104,29 @@ func createPgPool(ctx context.Context) (*pgxpool.Pool, error) {
 	return pgPool, err
 }
 
+// createPgPoolFromFlags initializes a new PostgreSQL connection pool using connection flags with the given prefix.
+// ctx: The context for the pool initialization.
+// c: The command holding connection flags created by connectionFlags.
+// prefix: The prefix of the connection flags, e.g. "source" or "target".
+func createPgPoolFromFlags(ctx context.Context, c *cli.Command, prefix string) (*pgxpool.Pool, error) {
+	pgConfig := db.PostgresConfig{
+		Host:     c.String(prefix + "-host"),
+		Port:     c.String(prefix + "-port"),
+		User:     c.String(prefix + "-user"),
+		Password: c.String(prefix + "-password"),
+		Database: c.String(prefix + "-database"),
+	}
+	if err := pgConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s connection settings: %v", prefix, err)
+	}
+	pgPool, err := db.InitPostgresPool(ctx, pgConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s Postgres pool: %v", prefix, err)
+	}
+
+	return pgPool, nil
+}
+
 // createIncludedSchemas ensures that the schema of the starting table is included in the list of schemas to traverse.
 // includedSchemas: The initial slice of included schemas from command line flags.
 // schema: The schema of the starting table.
@@ -76,107 +146,389 @@ func createIncludedSchemas(includedSchemas []string, schema string) []string {
 	return includedSchemas
 }
 
+// createOutput opens the file to write the output to, standard output if no file name is given.
+// outputFileName: The name of the output file.
+func createOutput(outputFileName string) (io.WriteCloser, error) {
+	if outputFileName == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	outputFile, err := os.Create(outputFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file %s: %v", outputFileName, err)
+	}
+	return outputFile, nil
+}
+
+// nopCloser keeps standard output open when the output is closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
 // writeGraph writes the provided graph string to either a specified output file or standard output.
 // outputFileName: The name of the file to write to. If empty, output goes to standard output.
 // graph: The string representation of the graph to write.
 func writeGraph(outputFileName string, graph string) error {
-	var outputWriter io.Writer = os.Stdout // Default to standard output
+	outputWriter, err := createOutput(outputFileName)
+	if err != nil {
+		return err
+	}
+	defer outputWriter.Close()
+
+	fmt.Fprintln(outputWriter, graph)
+
+	return nil
+}
+
+// schemaFlags returns flags that control which part of the database schema is discovered.
+func schemaFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "included-tables",
+			Usage: "names of the tables to include in the traversal",
+		},
+		&cli.StringSliceFlag{
+			Name:  "excluded-tables",
+			Usage: "names of the tables to exclude from the traversal",
+		},
+		&cli.StringSliceFlag{
+			Name:  "included-schemas",
+			Usage: "names of the schemas to include in the traversal",
+		},
+		&cli.StringFlag{
+			Name:  "virtual-relationships",
+			Usage: "YAML or JSON file with relationships which are not declared as foreign keys",
+		},
+	}
+}
 
-	if outputFileName != "" {
-		outputFile, err := os.Create(outputFileName)
+// loadVirtualRelationships loads the file given with the virtual-relationships flag.
+// c: The command holding flags created by schemaFlags.
+func loadVirtualRelationships(c *cli.Command) ([]parser.VirtualRelationship, error) {
+	if c.String("virtual-relationships") == "" {
+		return nil, nil
+	}
+	relationships, err := parser.LoadVirtualRelationships(c.String("virtual-relationships"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load virtual relationships: %v", err)
+	}
+	return relationships, nil
+}
+
+// traversalFlags returns flags that define the entry record and how relationships are followed.
+func traversalFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "table",
+			Usage:    "name of the table to start traversing",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "schema",
+			Value: "public",
+			Usage: "schema of the given table",
+		},
+		&cli.StringSliceFlag{
+			Name:    "primary-key-fields",
+			Aliases: []string{"pk-fields"},
+			Value:   []string{"id"},
+			Usage:   "names of the fields that form the primary key of the record",
+		},
+		&cli.StringSliceFlag{
+			Name:    "primary-key-values",
+			Aliases: []string{"pk-values"},
+			Usage:   "values of the primary key of the records to start traversing, one group of values per primary key field for each record",
+		},
+		&cli.StringFlag{
+			Name:  "where",
+			Usage: "SQL predicate selecting the records of the table to start traversing, instead of primary key values",
+		},
+		&cli.StringFlag{
+			Name:  "query",
+			Usage: "SQL query returning the primary key columns of the records to start traversing, instead of primary key values",
+		},
+		&cli.BoolFlag{
+			Name:  "follow-parents",
+			Value: true,
+			Usage: "whether to follow parent relationships",
+		},
+		&cli.BoolFlag{
+			Name:  "follow-children",
+			Value: true,
+			Usage: "whether to follow child relationships",
+		},
+		&cli.StringFlag{
+			Name:  "schema-cache",
+			Usage: "file to load the discovered schema from, it is refreshed when the schema changes",
+		},
+		&cli.StringFlag{
+			Name:  "relationship-rules",
+			Usage: "YAML or JSON file with rules following or skipping specific relationships",
+		},
+		&cli.StringFlag{
+			Name:  "row-filters",
+			Usage: "YAML or JSON file with SQL predicates child records of a table have to match, keyed by table name",
+		},
+		&cli.StringFlag{
+			Name:  "masking-rules",
+			Usage: "YAML or JSON file with rules masking values of columns before they are written",
+		},
+		&cli.StringFlag{
+			Name:    "masking-salt",
+			Usage:   "secret mixed into masked values, keep it to get the same masked values across runs",
+			Sources: cli.EnvVars("MASKING_SALT"),
+		},
+		&cli.StringFlag{
+			Name:  "remap-keys",
+			Value: string(parser.KeyRemapNone),
+			Usage: "how primary keys of extracted records are rewritten: none, offset (by --key-offset), sequence (next values of their sequences) or uuid",
+		},
+		&cli.IntFlag{
+			Name:  "key-offset",
+			Usage: "number added to integer primary keys with --remap-keys offset",
+		},
+		&cli.IntFlag{
+			Name:  "max-depth",
+			Usage: "maximum number of relationship hops from the entry record, 0 for no limit",
+		},
+		&cli.IntFlag{
+			Name:  "max-parent-depth",
+			Usage: "maximum number of parent hops from the entry record, 0 for no limit",
+		},
+		&cli.IntFlag{
+			Name:  "max-child-depth",
+			Usage: "maximum number of child hops from the entry record, 0 for no limit",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Value: 1,
+			Usage: "maximum number of relationships expanded in parallel, each using a connection of the pool",
+		},
+		&cli.BoolFlag{
+			Name:  "consistent-snapshot",
+			Usage: "read the whole traversal from one snapshot of the database in read only transactions",
+		},
+	}, schemaFlags()...)
+}
+
+// connectionFlags returns flags with PostgreSQL connection settings, prefixed with the given name.
+// Each flag falls back to the environment variable of the same setting, e.g. TARGET_POSTGRES_HOST.
+// prefix: The prefix of the flags, e.g. "source" or "target".
+// envPrefix: The prefix of the environment variables, e.g. "" or "TARGET_".
+func connectionFlags(prefix string, envPrefix string) []cli.Flag {
+	settings := []struct {
+		name string
+		env  string
+	}{
+		{"host", "POSTGRES_HOST"},
+		{"port", "POSTGRES_PORT"},
+		{"user", "POSTGRES_USER"},
+		{"password", "POSTGRES_PASSWORD"},
+		{"database", "POSTGRES_DB"},
+	}
+	flags := make([]cli.Flag, len(settings))
+	for i, setting := range settings {
+		flags[i] = &cli.StringFlag{
+			Name:    prefix + "-" + setting.name,
+			Usage:   fmt.Sprintf("%s of the %s database", setting.name, prefix),
+			Sources: cli.EnvVars(envPrefix + setting.env),
+		}
+	}
+	return flags
+}
+
+// parserConfigOpts builds parser configuration options from the traversal flags.
+// c: The command holding flags created by traversalFlags.
+func parserConfigOpts(c *cli.Command) ([]parser.ConfigOpt, error) {
+	includedSchemas := createIncludedSchemas(c.StringSlice("included-schemas"), c.String("schema"))
+
+	var rules []parser.RelationshipRule
+	if c.String("relationship-rules") != "" {
+		var err error
+		rules, err = parser.LoadRelationshipRules(c.String("relationship-rules"))
 		if err != nil {
-			return fmt.Errorf("failed to create output file %s: %v", outputFileName, err)
+			return nil, fmt.Errorf("failed to load relationship rules: %v", err)
 		}
-		defer outputFile.Close()
+	}
 
-		outputWriter = outputFile
+	virtualRelationships, err := loadVirtualRelationships(c)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Fprintln(outputWriter, graph)
+	keyRemap, err := parser.ParseKeyRemapMode(c.String("remap-keys"))
+	if err != nil {
+		return nil, err
+	}
+	if keyRemap == parser.KeyRemapOffset && c.Int("key-offset") == 0 {
+		return nil, fmt.Errorf("--remap-keys offset requires a --key-offset")
+	}
+	// The source database is only ever read, sequences are advanced where the records are loaded
+	if keyRemap == parser.KeyRemapSequence && c.String("target-database") == "" {
+		return nil, fmt.Errorf("--remap-keys sequence requires the --target-* connection of the database the records are loaded into")
+	}
 
-	return nil
+	// COPY blocks hold every record of a table and can't handle existing rows
+	if c.String("format") == string(parser.FormatCopy) {
+		for _, name := range []string{"on-conflict", "batch-size"} {
+			if c.IsSet(name) {
+				return nil, fmt.Errorf("--%s can't be used with --format copy", name)
+			}
+		}
+	}
+
+	var maskingRules []parser.MaskingRule
+	if c.String("masking-rules") != "" {
+		maskingRules, err = parser.LoadMaskingRules(c.String("masking-rules"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load masking rules: %v", err)
+		}
+	}
+
+	var rowFilters map[string]string
+	if c.String("row-filters") != "" {
+		rowFilters, err = parser.LoadRowFilters(c.String("row-filters"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load row filters: %v", err)
+		}
+	}
+
+	return []parser.ConfigOpt{
+		parser.WithSchemas(includedSchemas),
+		parser.WithIncludedTables(c.StringSlice("included-tables")),
+		parser.WithExcludedTables(c.StringSlice("excluded-tables")),
+		parser.WithFollowParents(c.Bool("follow-parents")),
+		parser.WithFollowChildren(c.Bool("follow-children")),
+		parser.WithSchemaCache(c.String("schema-cache")),
+		parser.WithMaxDepth(int(c.Int("max-depth"))),
+		parser.WithMaxParentDepth(int(c.Int("max-parent-depth"))),
+		parser.WithMaxChildDepth(int(c.Int("max-child-depth"))),
+		parser.WithRelationshipRules(rules),
+		parser.WithVirtualRelationships(virtualRelationships),
+		parser.WithRowFilters(rowFilters),
+		parser.WithMaskingRules(maskingRules),
+		parser.WithMaskingSalt(c.String("masking-salt")),
+		parser.WithKeyRemap(keyRemap),
+		parser.WithKeyOffset(c.Int("key-offset")),
+		parser.WithConcurrency(int(c.Int("concurrency"))),
+		parser.WithConsistentSnapshot(c.Bool("consistent-snapshot")),
+	}, nil
 }
 
-func main() {
-	cmd := &cli.Command{
-		Name:  "traverse",
-		Usage: "traverse table and extract the given record and its related records",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:     "table",
-				Usage:    "name of the table to start traversing",
-				Required: true,
-			},
+func traverseCommand() *cli.Command {
+	var job jobConfig
+	return &cli.Command{
+		Name:   "traverse",
+		Usage:  "traverse table and extract the given record and its related records",
+		Before: job.load,
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
-				Name:  "schema",
-				Value: "public",
-				Usage: "schema of the given table",
-			},
-			&cli.StringSliceFlag{
-				Name:    "primary-key-fields",
-				Aliases: []string{"pk-fields"},
-				Value:   []string{"id"},
-				Usage:   "names of the fields that form the primary key of the record",
-			},
-			&cli.StringSliceFlag{
-				Name:     "primary-key-values",
-				Aliases:  []string{"pk-values"},
-				Usage:    "values of the primary key of the record to start traversing",
-				Required: true,
+				Name:  "config",
+				Usage: "YAML file with the options of the job, keyed by flag name, flags given on the command line take precedence",
 			},
 			&cli.StringFlag{
 				Name:  "output",
 				Usage: "file to write the output to",
 			},
-			&cli.StringSliceFlag{
-				Name:  "included-tables",
-				Usage: "names of the tables to include in the traversal",
-			},
-			&cli.StringSliceFlag{
-				Name:  "excluded-tables",
-				Usage: "names of the tables to exclude from the traversal",
+			&cli.StringFlag{
+				Name:  "on-conflict",
+				Value: string(parser.ConflictNone),
+				Usage: "how generated inserts handle existing rows: none, do-nothing or do-update",
 			},
-			&cli.StringSliceFlag{
-				Name:  "included-schemas",
-				Usage: "names of the schemas to include in the traversal",
+			&cli.IntFlag{
+				Name:  "batch-size",
+				Value: 1,
+				Usage: "maximum number of consecutive records of the same table written by a single insert",
 			},
 			&cli.BoolFlag{
-				Name:  "follow-parents",
-				Value: true,
-				Usage: "whether to follow parent relationships",
+				Name:  "stream",
+				Usage: "write records while the graph is traversed instead of collecting it first, keeps memory bounded for sql and ndjson output",
 			},
-			&cli.BoolFlag{
-				Name:  "follow-children",
-				Value: true,
-				Usage: "whether to follow child relationships",
+			&cli.StringFlag{
+				Name:  "format",
+				Value: string(parser.FormatSQL),
+				Usage: "output format: sql (INSERT statements), copy (COPY ... FROM stdin blocks), json, ndjson, dot or mermaid",
 			},
-		},
+		}, append(connectionFlags("target", "TARGET_"), traversalFlags()...)...),
 		Action: func(ctx context.Context, c *cli.Command) error {
+			conflictMode, err := parser.ParseConflictMode(c.String("on-conflict"))
+			if err != nil {
+				return err
+			}
+			format, err := parser.ParseOutputFormat(c.String("format"))
+			if err != nil {
+				return err
+			}
+
 			pgPool, err := createPgPool(ctx)
 			if err != nil {
 				return fmt.Errorf("failed to create Postgres pool: %v", err)
 			}
 
-			includedSchemas := createIncludedSchemas(c.StringSlice("included-schemas"), c.String("schema"))
-
-			// Construct primary key for the value we use to start traversing
-			pk, err := createPK(c.StringSlice("primary-key-fields"), c.StringSlice("primary-key-values"))
+			opts, err := parserConfigOpts(c)
 			if err != nil {
-				return fmt.Errorf("failed to create primary key: %v", err)
+				return err
 			}
-
-			p, err := parser.NewParser(pgPool, parser.NewParserConfig(
-				parser.WithSchemas(includedSchemas),
-				parser.WithIncludedTables(c.StringSlice("included-tables")),
-				parser.WithExcludedTables(c.StringSlice("excluded-tables")),
-				parser.WithFollowParents(c.Bool("follow-parents")),
-				parser.WithFollowChildren(c.Bool("follow-children")),
-			))
+			if !c.IsSet("relationship-rules") {
+				opts = append(opts, parser.WithRelationshipRules(job.relationshipRules))
+			}
+			if !c.IsSet("virtual-relationships") {
+				opts = append(opts, parser.WithVirtualRelationships(job.virtualRelationships))
+			}
+			if !c.IsSet("row-filters") {
+				opts = append(opts, parser.WithRowFilters(job.rowFilters))
+			}
+			if !c.IsSet("masking-rules") {
+				opts = append(opts, parser.WithMaskingRules(job.maskingRules))
+			}
+			opts = append(opts,
+				parser.WithConflictMode(conflictMode),
+				parser.WithBatchSize(int(c.Int("batch-size"))),
+				parser.WithFormat(format),
+			)
+			// Sequences are advanced in the database the output is loaded into
+			if c.String("remap-keys") == string(parser.KeyRemapSequence) {
+				targetPool, err := createPgPoolFromFlags(ctx, c, "target")
+				if err != nil {
+					return err
+				}
+				defer targetPool.Close()
+				opts = append(opts, parser.WithSequencePool(targetPool))
+			}
+			p, err := parser.NewParser(pgPool, parser.NewParserConfig(opts...))
 			if err != nil {
 				return fmt.Errorf("failed to initialize parser: %v", err)
 			}
 
-			graph, err := p.ExtractGraph(ctx, parser.Table{Name: c.String("table"), Schema: c.String("schema")}, pk)
+			// Entry records are selected from the snapshot the graph is read from
+			if c.Bool("consistent-snapshot") {
+				if err := p.BeginSnapshot(ctx); err != nil {
+					return fmt.Errorf("failed to begin snapshot: %v", err)
+				}
+				defer p.EndSnapshot(context.Background())
+			}
+
+			// Construct primary keys of the records we use to start traversing
+			pks, err := entryKeys(ctx, c, p)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("stream") {
+				output, err := createOutput(c.String("output"))
+				if err != nil {
+					return fmt.Errorf("failed to write graph: %v", err)
+				}
+				defer output.Close()
+
+				if _, err := p.StreamGraph(ctx, output, parser.Table{Name: c.String("table"), Schema: c.String("schema")}, pks...); err != nil {
+					return fmt.Errorf("failed to stream records graph: %v", err)
+				}
+				return nil
+			}
+
+			graph, err := p.ExtractGraph(ctx, parser.Table{Name: c.String("table"), Schema: c.String("schema")}, pks...)
 			if err != nil {
 				return fmt.Errorf("failed to extract records graph: %v", err)
 			}
@@ -188,6 +540,185 @@ func main() {
 			return nil
 		},
 	}
+}
+
+func copyCommand() *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "on-conflict",
+			Value: "fail",
+			Usage: "what to do with records which already exist in the target database: fail, skip or update",
+		},
+	}
+	flags = append(flags, connectionFlags("source", "")...)
+	flags = append(flags, connectionFlags("target", "TARGET_")...)
+
+	return &cli.Command{
+		Name:  "copy",
+		Usage: "copy the given record and its related records from the source database into the target database",
+		Flags: append(flags, traversalFlags()...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			conflictMode, err := parser.ParseConflictMode(c.String("on-conflict"))
+			if err != nil {
+				return err
+			}
+
+			sourcePool, err := createPgPoolFromFlags(ctx, c, "source")
+			if err != nil {
+				return err
+			}
+			defer sourcePool.Close()
+
+			targetPool, err := createPgPoolFromFlags(ctx, c, "target")
+			if err != nil {
+				return err
+			}
+			defer targetPool.Close()
+
+			opts, err := parserConfigOpts(c)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, parser.WithConflictMode(conflictMode))
+			p, err := parser.NewParser(sourcePool, parser.NewParserConfig(opts...))
+			if err != nil {
+				return fmt.Errorf("failed to initialize parser: %v", err)
+			}
+
+			// Entry records are selected from the snapshot the graph is read from
+			if c.Bool("consistent-snapshot") {
+				if err := p.BeginSnapshot(ctx); err != nil {
+					return fmt.Errorf("failed to begin snapshot: %v", err)
+				}
+				defer p.EndSnapshot(context.Background())
+			}
+
+			// Construct primary keys of the records we use to start traversing
+			pks, err := entryKeys(ctx, c, p)
+			if err != nil {
+				return err
+			}
+
+			copied, err := p.CopyGraph(ctx, targetPool, parser.Table{Name: c.String("table"), Schema: c.String("schema")}, pks...)
+			if err != nil {
+				return fmt.Errorf("failed to copy records graph: %v", err)
+			}
+			log.Printf("copied %d records", copied)
+
+			return nil
+		},
+	}
+}
+
+func schemaCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "schema",
+		Usage: "inspect the discovered database schema",
+		Commands: []*cli.Command{
+			{
+				Name:  "dump",
+				Usage: "discover tables and relationships and dump them as JSON, usable with --schema-cache",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "file to write the output to",
+					},
+				}, schemaFlags()...),
+				Action: func(ctx context.Context, c *cli.Command) error {
+					p, err := createSchemaParser(ctx, c)
+					if err != nil {
+						return err
+					}
+
+					snapshot, err := p.Snapshot(ctx)
+					if err != nil {
+						return fmt.Errorf("failed to take schema snapshot: %v", err)
+					}
+
+					if c.String("output") != "" {
+						if err := snapshot.Save(c.String("output")); err != nil {
+							return fmt.Errorf("failed to write schema: %v", err)
+						}
+						return nil
+					}
+
+					data, err := json.MarshalIndent(snapshot, "", "  ")
+					if err != nil {
+						return fmt.Errorf("failed to encode schema: %v", err)
+					}
+					return writeGraph("", string(data))
+				},
+			},
+			{
+				Name:  "diagram",
+				Usage: "render discovered tables and relationships as an entity relationship diagram",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "file to write the output to",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: string(parser.FormatMermaid),
+						Usage: "diagram format: mermaid (erDiagram) or dot",
+					},
+				}, schemaFlags()...),
+				Action: func(ctx context.Context, c *cli.Command) error {
+					format, err := parser.ParseOutputFormat(c.String("format"))
+					if err != nil {
+						return err
+					}
+
+					p, err := createSchemaParser(ctx, c)
+					if err != nil {
+						return err
+					}
+
+					diagram, err := p.GenerateSchemaDiagram(format)
+					if err != nil {
+						return fmt.Errorf("failed to render schema diagram: %v", err)
+					}
+					return writeGraph(c.String("output"), diagram)
+				},
+			},
+		},
+	}
+}
+
+// createSchemaParser discovers the schema selected by the flags created by schemaFlags.
+func createSchemaParser(ctx context.Context, c *cli.Command) (*parser.Parser, error) {
+	virtualRelationships, err := loadVirtualRelationships(c)
+	if err != nil {
+		return nil, err
+	}
+
+	pgPool, err := createPgPool(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Postgres pool: %v", err)
+	}
+
+	p, err := parser.NewParser(pgPool, parser.NewParserConfig(
+		parser.WithSchemas(c.StringSlice("included-schemas")),
+		parser.WithIncludedTables(c.StringSlice("included-tables")),
+		parser.WithExcludedTables(c.StringSlice("excluded-tables")),
+		parser.WithVirtualRelationships(virtualRelationships),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize parser: %v", err)
+	}
+	return p, nil
+}
+
+func main() {
+	cmd := &cli.Command{
+		Name:  "traversql",
+		Usage: "extract graphs of related records from a PostgreSQL database",
+		Commands: []*cli.Command{
+			traverseCommand(),
+			copyCommand(),
+			schemaCommand(),
+		},
+	}
 
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
 		log.Fatal(err)
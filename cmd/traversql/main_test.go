@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParserConfigOpts(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "sql with conflict mode and batch size",
+			args: []string{"--on-conflict", "do-nothing", "--batch-size", "10"},
+		},
+		{
+			name: "copy",
+			args: []string{"--format", "copy"},
+		},
+		{
+			name:     "copy with conflict mode",
+			args:     []string{"--format", "copy", "--on-conflict", "do-nothing"},
+			expected: "--on-conflict can't be used with --format copy",
+		},
+		{
+			name:     "copy with batch size",
+			args:     []string{"--format", "copy", "--batch-size", "10"},
+			expected: "--batch-size can't be used with --format copy",
+		},
+		{
+			name:     "sequence remap without target",
+			args:     []string{"--remap-keys", "sequence"},
+			expected: "--remap-keys sequence requires the --target-* connection of the database the records are loaded into",
+		},
+		{
+			name: "sequence remap with target",
+			args: []string{"--remap-keys", "sequence", "--target-database", "staging"},
+		},
+		{
+			name:     "offset remap without offset",
+			args:     []string{"--remap-keys", "offset"},
+			expected: "--remap-keys offset requires a --key-offset",
+		},
+	}
+
+	for _, c := range cases {
+		cmd, _, err := runJob(t, "table: orders\n", c.args...)
+		if !assert.NoError(t, err, "failed to run command for case %s", c.name) {
+			continue
+		}
+		_, err = parserConfigOpts(cmd)
+		if c.expected == "" {
+			assert.NoError(t, err, "unexpected error for case %s", c.name)
+		} else {
+			assert.EqualError(t, err, c.expected, "unexpected error for case %s", c.name)
+		}
+	}
+
+	// Options of a job file are checked as well
+	cmd, _, err := runJob(t, "table: orders\nformat: copy\nbatch-size: 10\n")
+	if assert.NoError(t, err) {
+		_, err = parserConfigOpts(cmd)
+		assert.EqualError(t, err, "--batch-size can't be used with --format copy")
+	}
+}
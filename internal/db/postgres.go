@@ -43,6 +43,27 @@ func checkPostgresEnvs() error {
 	return nil
 }
 
+// Validate verifies that all connection parameters are set.
+func (c PostgresConfig) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("host is not set")
+	}
+	if c.Port == "" {
+		return fmt.Errorf("port is not set")
+	}
+	if c.User == "" {
+		return fmt.Errorf("user is not set")
+	}
+	if c.Password == "" {
+		return fmt.Errorf("password is not set")
+	}
+	if c.Database == "" {
+		return fmt.Errorf("database is not set")
+	}
+
+	return nil
+}
+
 // NewPostgresConfigFromEnvs retrieves database configuration from environment variables
 // and returns a PostgresConfig struct. It also checks if all required environment variables
 // are set before returning the configuration.
@@ -0,0 +1,271 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Snapshot of the system catalog for the configured schemas.
+//
+// The whole schema is read with a handful of bulk queries against pg_catalog
+// and every Table, Column and Relationship is then built in memory. Unlike
+// information_schema, pg_catalog does not hide objects the current role has
+// no privileges on.
+type catalog struct {
+	tables      []catalogTable
+	tablesByOID map[uint32]*catalogTable
+	foreignKeys []catalogForeignKey
+}
+
+type catalogTable struct {
+	oid   uint32
+	table Table
+	// Column numbers (attnum) in the same order as table.Columns
+	attnums []int16
+	// Column numbers of every primary key and unique index of the table
+	uniqueKeys [][]int16
+	// Maximum length of the character columns with a length limit, by column name
+	maxLengths map[string]int
+}
+
+type catalogForeignKey struct {
+	name          string
+	sourceOID     uint32
+	sourceSchema  string
+	sourceTable   string
+	sourceAttnums []int16
+	targetOID     uint32
+	targetSchema  string
+	targetTable   string
+	targetAttnums []int16
+}
+
+// Columns of ordinary and partitioned tables. The data_type expression mirrors
+// the one information_schema.columns uses so type names stay the same.
+const catalogColumnsQuery = `
+    SELECT
+        c.oid,
+        n.nspname,
+        c.relname,
+        a.attname,
+        a.attnum,
+        CASE
+            WHEN t.typtype = 'd' THEN
+                CASE
+                    WHEN bt.typelem <> 0 AND bt.typlen = -1 THEN 'ARRAY'
+                    WHEN btn.nspname = 'pg_catalog' THEN format_type(t.typbasetype, NULL)
+                    ELSE 'USER-DEFINED'
+                END
+            ELSE
+                CASE
+                    WHEN t.typelem <> 0 AND t.typlen = -1 THEN 'ARRAY'
+                    WHEN tn.nspname = 'pg_catalog' THEN format_type(a.atttypid, NULL)
+                    ELSE 'USER-DEFINED'
+                END
+        END AS data_type,
+        COALESCE(a.attnum = ANY(pk.indkey::int2[]), false) AS is_primary,
+        NOT a.attnotnull AS is_nullable,
+        CASE
+            WHEN a.atttypid IN ('varchar'::regtype, 'bpchar'::regtype) AND a.atttypmod > 4 THEN a.atttypmod - 4
+        END AS max_length
+    FROM
+        pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+        JOIN pg_type t ON t.oid = a.atttypid
+        JOIN pg_namespace tn ON tn.oid = t.typnamespace
+        LEFT JOIN pg_type bt ON t.typtype = 'd' AND bt.oid = t.typbasetype
+        LEFT JOIN pg_namespace btn ON btn.oid = bt.typnamespace
+        LEFT JOIN pg_index pk ON pk.indrelid = c.oid AND pk.indisprimary
+    WHERE
+        c.relkind IN ('r', 'p')
+        AND n.nspname = ANY($1)
+        AND ($2::text IS NULL OR c.relname::text = $2::text)
+    ORDER BY
+        c.oid,
+        a.attnum
+`
+
+// Primary keys and unique indexes, partial and expression indexes
+// can't guarantee uniqueness of plain column values so they are skipped
+const catalogUniqueKeysQuery = `
+    SELECT
+        i.indrelid,
+        i.indkey::int2[]
+    FROM
+        pg_index i
+        JOIN pg_class c ON c.oid = i.indrelid
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+    WHERE
+        i.indisunique
+        AND i.indpred IS NULL
+        AND i.indexprs IS NULL
+        AND n.nspname = ANY($1)
+`
+
+const catalogForeignKeysQuery = `
+    SELECT
+        con.conname,
+        con.conrelid,
+        n.nspname,
+        c.relname,
+        con.conkey,
+        con.confrelid,
+        tn.nspname,
+        tc.relname,
+        con.confkey
+    FROM
+        pg_constraint con
+        JOIN pg_class c ON c.oid = con.conrelid
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        JOIN pg_class tc ON tc.oid = con.confrelid
+        JOIN pg_namespace tn ON tn.oid = tc.relnamespace
+    WHERE
+        con.contype = 'f'
+        AND n.nspname = ANY($1)
+    ORDER BY
+        con.oid
+`
+
+// Read tables, keys and foreign keys of the configured schemas
+func (p *Parser) loadCatalog(ctx context.Context) (*catalog, error) {
+	cat := &catalog{
+		tablesByOID: make(map[uint32]*catalogTable),
+	}
+
+	tables, err := queryCatalogTables(ctx, p.pool, p.config.Schemas, nil)
+	if err != nil {
+		return nil, err
+	}
+	cat.tables = tables
+	for i := range cat.tables {
+		cat.tablesByOID[cat.tables[i].oid] = &cat.tables[i]
+	}
+
+	rows, err := p.pool.Query(ctx, catalogUniqueKeysQuery, p.config.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unique keys: %w", err)
+	}
+	for rows.Next() {
+		var oid uint32
+		var attnums []int16
+		if err := rows.Scan(&oid, &attnums); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan unique key row: %w", err)
+		}
+		if t, ok := cat.tablesByOID[oid]; ok {
+			t.uniqueKeys = append(t.uniqueKeys, attnums)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unique key rows: %w", err)
+	}
+
+	rows, err = p.pool.Query(ctx, catalogForeignKeysQuery, p.config.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query foreign keys: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk catalogForeignKey
+		if err := rows.Scan(
+			&fk.name,
+			&fk.sourceOID, &fk.sourceSchema, &fk.sourceTable, &fk.sourceAttnums,
+			&fk.targetOID, &fk.targetSchema, &fk.targetTable, &fk.targetAttnums,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key row: %w", err)
+		}
+		cat.foreignKeys = append(cat.foreignKeys, fk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating foreign key rows: %w", err)
+	}
+
+	return cat, nil
+}
+
+// Query tables with their columns, optionally limited to a single table name
+func queryCatalogTables(ctx context.Context, pool *pgxpool.Pool, schemas []string, name *string) ([]catalogTable, error) {
+	rows, err := pool.Query(ctx, catalogColumnsQuery, schemas, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []catalogTable
+	for rows.Next() {
+		var oid uint32
+		var schema, table string
+		var attnum int16
+		var col Column
+		var maxLength *int32
+		if err := rows.Scan(&oid, &schema, &table, &col.Name, &attnum, &col.DataType, &col.IsPrimary, &col.IsNullable, &maxLength); err != nil {
+			return nil, fmt.Errorf("failed to scan column row: %w", err)
+		}
+		if len(tables) == 0 || tables[len(tables)-1].oid != oid {
+			tables = append(tables, catalogTable{
+				oid:   oid,
+				table: Table{Schema: schema, Name: table},
+			})
+		}
+		t := &tables[len(tables)-1]
+		t.table.Columns = append(t.table.Columns, col)
+		t.attnums = append(t.attnums, attnum)
+		if maxLength != nil {
+			if t.maxLengths == nil {
+				t.maxLengths = make(map[string]int)
+			}
+			t.maxLengths[col.Name] = int(*maxLength)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating column rows: %w", err)
+	}
+
+	return tables, nil
+}
+
+// Get columns of the table by their column numbers
+func (t *catalogTable) columnsOf(attnums []int16) ([]Column, error) {
+	columns := make([]Column, len(attnums))
+	for i, attnum := range attnums {
+		found := false
+		for j, n := range t.attnums {
+			if n == attnum {
+				columns[i] = t.table.Columns[j]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %d not found in table %s", attnum, t.table.FullName())
+		}
+	}
+	return columns, nil
+}
+
+// Check that every given column is part of a primary key or unique index
+func (t *catalogTable) areColumnsUnique(attnums []int16) bool {
+	for _, attnum := range attnums {
+		isUnique := false
+		for _, key := range t.uniqueKeys {
+			for _, n := range key {
+				if n == attnum {
+					isUnique = true
+					break
+				}
+			}
+			if isUnique {
+				break
+			}
+		}
+		if !isUnique {
+			return false
+		}
+	}
+	return len(attnums) > 0
+}
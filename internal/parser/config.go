@@ -1,5 +1,66 @@
 package parser
 
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// What to do when an inserted record already exists in the target database
+type ConflictMode string
+
+const (
+	// Plain INSERT, fails on the first duplicate key
+	ConflictNone ConflictMode = "none"
+	// ON CONFLICT DO NOTHING, keeps the existing row
+	ConflictDoNothing ConflictMode = "do-nothing"
+	// ON CONFLICT DO UPDATE, overwrites the existing row with the extracted values
+	ConflictDoUpdate ConflictMode = "do-update"
+)
+
+// ParseConflictMode converts a string to a ConflictMode, "fail", "skip"
+// and "update" are accepted as aliases of the modes above
+func ParseConflictMode(s string) (ConflictMode, error) {
+	switch s {
+	case string(ConflictNone), "fail":
+		return ConflictNone, nil
+	case string(ConflictDoNothing), "skip":
+		return ConflictDoNothing, nil
+	case string(ConflictDoUpdate), "update":
+		return ConflictDoUpdate, nil
+	default:
+		return "", fmt.Errorf("unknown conflict mode %q", s)
+	}
+}
+
+// Format of the extracted graph
+type OutputFormat string
+
+const (
+	// INSERT statements
+	FormatSQL OutputFormat = "sql"
+	// COPY ... FROM stdin blocks, as written by pg_dump
+	FormatCopy OutputFormat = "copy"
+	// Single JSON document with records and the edges between them
+	FormatJSON OutputFormat = "json"
+	// One JSON object per line for every record and edge
+	FormatNDJSON OutputFormat = "ndjson"
+	// Graphviz digraph of records
+	FormatDOT OutputFormat = "dot"
+	// Mermaid flowchart of records
+	FormatMermaid OutputFormat = "mermaid"
+)
+
+// ParseOutputFormat converts a string to an OutputFormat
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch format := OutputFormat(s); format {
+	case FormatSQL, FormatCopy, FormatJSON, FormatNDJSON, FormatDOT, FormatMermaid:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q", s)
+	}
+}
+
 // Configuration for the extraction
 type parserConfig struct {
 	// Schemas to extract from
@@ -12,6 +73,44 @@ type parserConfig struct {
 	FollowParents bool
 	// Whether to follow child relationships (foreign keys from other tables pointing to this one)
 	FollowChildren bool
+	// File to load the discovered schema from (and store it to when outdated)
+	SchemaCache string
+	// How to handle records which already exist in the target database
+	ConflictMode ConflictMode
+	// Maximum number of consecutive records of the same table written by a single INSERT
+	BatchSize int
+	// Format of the extracted graph
+	Format OutputFormat
+	// Maximum number of hops from the entry record, 0 means unlimited
+	MaxDepth int
+	// Maximum number of parent hops from the entry record, 0 means unlimited
+	MaxParentDepth int
+	// Maximum number of child hops from the entry record, 0 means unlimited
+	MaxChildDepth int
+	// Rules overriding FollowParents and FollowChildren for specific relationships
+	RelationshipRules []RelationshipRule
+	// Relationships which are not declared as foreign keys in the database
+	VirtualRelationships []VirtualRelationship
+	// SQL predicates child records have to match to be followed, keyed by `table` or `schema.table`
+	RowFilters map[string]string
+	// Rules masking values of columns before they are written
+	MaskingRules []MaskingRule
+	// Secret mixed into masked values, so they can't be matched by masking known values
+	MaskingSalt string
+	// How primary keys of extracted records are rewritten
+	KeyRemap KeyRemapMode
+	// Added to integer primary keys by the offset key remap mode
+	KeyOffset int64
+	// Database the output is loaded into, sequences of the sequence key remap mode are advanced
+	// there as the source database is only ever read
+	SequencePool *pgxpool.Pool
+	// Maximum number of lookups of a traversal level running at the same time
+	Concurrency int
+	// Whether every query of a traversal reads the same snapshot of the database
+	ConsistentSnapshot bool
+
+	// Relationship rules with their parsed matches, set up by NewParser
+	rules []compiledRule
 }
 
 func NewParserConfig(opts ...ConfigOpt) *parserConfig {
@@ -21,6 +120,11 @@ func NewParserConfig(opts ...ConfigOpt) *parserConfig {
 		IncludedTables: []string{},
 		FollowParents:  true,
 		FollowChildren: true,
+		ConflictMode:   ConflictNone,
+		KeyRemap:       KeyRemapNone,
+		BatchSize:      1,
+		Format:         FormatSQL,
+		Concurrency:    1,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -28,6 +132,12 @@ func NewParserConfig(opts ...ConfigOpt) *parserConfig {
 	if len(c.Schemas) == 0 {
 		c.Schemas = []string{"public"}
 	}
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.Concurrency < 1 {
+		c.Concurrency = 1
+	}
 	return c
 }
 
@@ -62,3 +172,110 @@ func WithFollowChildren(follow bool) ConfigOpt {
 		c.FollowChildren = follow
 	}
 }
+
+func WithSchemaCache(path string) ConfigOpt {
+	return func(c *parserConfig) {
+		c.SchemaCache = path
+	}
+}
+
+func WithConflictMode(mode ConflictMode) ConfigOpt {
+	return func(c *parserConfig) {
+		c.ConflictMode = mode
+	}
+}
+
+func WithBatchSize(size int) ConfigOpt {
+	return func(c *parserConfig) {
+		c.BatchSize = size
+	}
+}
+
+func WithFormat(format OutputFormat) ConfigOpt {
+	return func(c *parserConfig) {
+		c.Format = format
+	}
+}
+
+func WithMaxDepth(hops int) ConfigOpt {
+	return func(c *parserConfig) {
+		c.MaxDepth = hops
+	}
+}
+
+func WithMaxParentDepth(hops int) ConfigOpt {
+	return func(c *parserConfig) {
+		c.MaxParentDepth = hops
+	}
+}
+
+func WithMaxChildDepth(hops int) ConfigOpt {
+	return func(c *parserConfig) {
+		c.MaxChildDepth = hops
+	}
+}
+
+func WithRelationshipRules(rules []RelationshipRule) ConfigOpt {
+	return func(c *parserConfig) {
+		c.RelationshipRules = append(c.RelationshipRules, rules...)
+	}
+}
+
+func WithVirtualRelationships(relationships []VirtualRelationship) ConfigOpt {
+	return func(c *parserConfig) {
+		c.VirtualRelationships = append(c.VirtualRelationships, relationships...)
+	}
+}
+
+func WithRowFilters(filters map[string]string) ConfigOpt {
+	return func(c *parserConfig) {
+		if c.RowFilters == nil {
+			c.RowFilters = make(map[string]string, len(filters))
+		}
+		for table, predicate := range filters {
+			c.RowFilters[table] = predicate
+		}
+	}
+}
+
+func WithMaskingRules(rules []MaskingRule) ConfigOpt {
+	return func(c *parserConfig) {
+		c.MaskingRules = append(c.MaskingRules, rules...)
+	}
+}
+
+func WithMaskingSalt(salt string) ConfigOpt {
+	return func(c *parserConfig) {
+		c.MaskingSalt = salt
+	}
+}
+
+func WithKeyRemap(mode KeyRemapMode) ConfigOpt {
+	return func(c *parserConfig) {
+		c.KeyRemap = mode
+	}
+}
+
+func WithKeyOffset(offset int64) ConfigOpt {
+	return func(c *parserConfig) {
+		c.KeyOffset = offset
+	}
+}
+
+func WithSequencePool(pool *pgxpool.Pool) ConfigOpt {
+	return func(c *parserConfig) {
+		c.SequencePool = pool
+	}
+}
+
+func WithConcurrency(workers int) ConfigOpt {
+	return func(c *parserConfig) {
+		c.Concurrency = workers
+	}
+}
+
+func WithConsistentSnapshot(consistent bool) ConfigOpt {
+	return func(c *parserConfig) {
+		c.ConsistentSnapshot = consistent
+	}
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Runs the queries of a traversal, either the pool or the transactions of a consistent snapshot
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Read only transactions sharing one snapshot of the database, so that every query of a traversal
+// sees the same data. A query takes a free transaction and gives it back once its rows are read.
+type snapshotReader struct {
+	txs  []pgx.Tx
+	free chan pgx.Tx
+}
+
+var snapshotTxOptions = pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+
+// Identifier returned by pg_export_snapshot, such as 00000003-0000001B-1
+var snapshotIDPattern = regexp.MustCompile(`^[0-9A-F]+(-[0-9A-F]+)+$`)
+
+// Begin the given number of transactions, the first one exports its snapshot and the others import it.
+// One connection of the pool is always left for the queries running outside of the snapshot, so the
+// pool needs at least two connections.
+func (p *Parser) beginSnapshotReader(ctx context.Context, workers int) (*snapshotReader, error) {
+	limit := int(p.pool.Config().MaxConns) - 1
+	if limit < 1 {
+		return nil, fmt.Errorf("a consistent snapshot needs a pool of at least 2 connections, it has %d", limit+1)
+	}
+	workers = min(workers, limit)
+	r := &snapshotReader{free: make(chan pgx.Tx, workers)}
+
+	tx, err := p.pool.BeginTx(ctx, snapshotTxOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+	r.add(tx)
+
+	// The snapshot is taken by the first statement of the transaction rather than by BEGIN,
+	// exporting it takes it now even when no other transaction imports it
+	var snapshotID string
+	if err := tx.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&snapshotID); err != nil {
+		r.close(ctx)
+		return nil, fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	// The identifier can't be passed as a parameter of SET TRANSACTION
+	if !snapshotIDPattern.MatchString(snapshotID) {
+		r.close(ctx)
+		return nil, fmt.Errorf("unexpected snapshot identifier %q", snapshotID)
+	}
+	for i := 1; i < workers; i++ {
+		tx, err := p.pool.BeginTx(ctx, snapshotTxOptions)
+		if err != nil {
+			r.close(ctx)
+			return nil, fmt.Errorf("failed to begin snapshot transaction: %w", err)
+		}
+		r.add(tx)
+		// Must be the first statement of the transaction
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshotID)); err != nil {
+			r.close(ctx)
+			return nil, fmt.Errorf("failed to import snapshot %s: %w", snapshotID, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *snapshotReader) add(tx pgx.Tx) {
+	r.txs = append(r.txs, tx)
+	r.free <- tx
+}
+
+// End every transaction of the snapshot, nothing was written so they are rolled back
+func (r *snapshotReader) close(ctx context.Context) {
+	for _, tx := range r.txs {
+		_ = tx.Rollback(ctx)
+	}
+}
+
+// Wait for a free transaction
+func (r *snapshotReader) acquire(ctx context.Context) (pgx.Tx, error) {
+	select {
+	case tx := <-r.free:
+		return tx, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *snapshotReader) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	tx, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		r.free <- tx
+		return nil, err
+	}
+	return &snapshotRows{Rows: rows, release: func() { r.free <- tx }}, nil
+}
+
+func (r *snapshotReader) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	tx, err := r.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return snapshotRow{Row: tx.QueryRow(ctx, sql, args...), release: func() { r.free <- tx }}
+}
+
+// Rows giving their transaction back when closed
+type snapshotRows struct {
+	pgx.Rows
+	release func()
+	once    sync.Once
+}
+
+func (r *snapshotRows) Close() {
+	r.Rows.Close()
+	r.once.Do(r.release)
+}
+
+// Row giving its transaction back once scanned
+type snapshotRow struct {
+	pgx.Row
+	release func()
+}
+
+func (r snapshotRow) Scan(dest ...any) error {
+	defer r.release()
+	return r.Row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
+
+// BeginSnapshot starts reading the database from a consistent snapshot ahead of the traversal, so that
+// the entry records selected with SelectEntryKeys or QueryEntryKeys and the graph built from them are
+// read from the same snapshot. Without it a traversal with WithConsistentSnapshot starts its own.
+// The snapshot is held until EndSnapshot.
+func (p *Parser) BeginSnapshot(ctx context.Context) error {
+	if p.reader != nil {
+		return fmt.Errorf("snapshot already started")
+	}
+	reader, err := p.beginSnapshotReader(ctx, p.config.Concurrency)
+	if err != nil {
+		return err
+	}
+	p.reader = reader
+	return nil
+}
+
+// EndSnapshot ends the snapshot started by BeginSnapshot
+func (p *Parser) EndSnapshot(ctx context.Context) {
+	if p.reader != nil {
+		p.reader.close(ctx)
+		p.reader = nil
+	}
+}
+
+// The snapshot of the running traversal if there is one, the pool otherwise
+func (p *Parser) querier() querier {
+	if p.reader != nil {
+		return p.reader
+	}
+	return p.pool
+}
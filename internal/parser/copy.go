@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Number of records written by a single INSERT statement when copying
+const copyBatchSize = 500
+
+// CopyGraph extracts the graph of records starting at the given records and writes
+// it into the target database in a single transaction. Returns the number of copied records.
+func (p *Parser) CopyGraph(ctx context.Context, target *pgxpool.Pool, table Table, pks ...PrimaryKey) (int, error) {
+	defer p.Reset()
+
+	records, err := p.BuildGraph(ctx, table, pks...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build graph: %w", err)
+	}
+
+	records, err = p.remapKeys(ctx, target, records)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remap keys: %w", err)
+	}
+
+	// Make sure referenced records are inserted first
+	records, updates := p.OrderRecords(records)
+	records, updates = p.maskRecords(records, updates)
+
+	tx, err := target.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, batch := range groupRecords(records, copyBatchSize) {
+		query, args := p.buildInsertQuery(batch)
+		// Simple protocol sends values as text literals, so the server converts
+		// them to column types the same way it does for values of an SQL file
+		args = append([]interface{}{pgx.QueryExecModeSimpleProtocol}, args...)
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return 0, fmt.Errorf("failed to insert records into %s: %w", batch[0].Table.FullName(), err)
+		}
+	}
+
+	for _, update := range updates {
+		query, args := buildUpdateQuery(update)
+		args = append([]interface{}{pgx.QueryExecModeSimpleProtocol}, args...)
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return 0, fmt.Errorf("failed to update records of %s: %w", update.Table.FullName(), err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(records), nil
+}
+
+// Split records into batches of consecutive records of the same table
+func groupRecords(records []Record, size int) [][]Record {
+	var batches [][]Record
+	for i, record := range records {
+		if i > 0 {
+			last := batches[len(batches)-1]
+			if len(last) < size && sameShape(last[0], record) {
+				batches[len(batches)-1] = append(last, record)
+				continue
+			}
+		}
+		batches = append(batches, []Record{record})
+	}
+	return batches
+}
+
+// Check that two records belong to the same table and have the same columns
+func sameShape(a, b Record) bool {
+	if a.Table.FullName() != b.Table.FullName() || len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i].Name != b.Columns[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// Build a parameterized multi-row INSERT statement for records of the same table
+func (p *Parser) buildInsertQuery(records []Record) (string, []interface{}) {
+	columns := records[0].Columns
+	columnNames := make([]string, len(columns))
+	for i, col := range columns {
+		columnNames[i] = col.Name
+	}
+
+	var args []interface{}
+	rows := make([]string, len(records))
+	for i, record := range records {
+		placeholders := make([]string, len(record.Values))
+		for j, val := range record.Values {
+			args = append(args, val)
+			placeholders[j] = fmt.Sprintf("$%d", len(args))
+		}
+		rows[i] = fmt.Sprintf("(%s)", strings.Join(placeholders, ", "))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s",
+		records[0].Table.FullName(), strings.Join(columnNames, ", "), strings.Join(rows, ", "),
+		p.onConflictClause(records[0].Table, columns))
+
+	return query, args
+}
+
+// Build a parameterized UPDATE statement restoring a deferred foreign key
+func buildUpdateQuery(update DeferredUpdate) (string, []interface{}) {
+	var args []interface{}
+	query := buildUpdateStatement(update, func(val interface{}) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	})
+	return query, args
+}
@@ -0,0 +1,111 @@
+package parser
+
+import "sync"
+
+// Number of hops between the entry record and a record of the graph
+type depth struct {
+	parents  int
+	children int
+}
+
+func (d depth) parent() depth { return depth{parents: d.parents + 1, children: d.children} }
+func (d depth) child() depth  { return depth{parents: d.parents, children: d.children + 1} }
+
+// Check whether the parents of a record at the given depth can be followed
+func (c *parserConfig) canFollowParents(d depth) bool {
+	next := d.parent()
+	return withinLimit(next.parents, c.MaxParentDepth) && withinLimit(next.parents+next.children, c.MaxDepth)
+}
+
+// Check whether the children of a record at the given depth can be followed
+func (c *parserConfig) canFollowChildren(d depth) bool {
+	next := d.child()
+	return withinLimit(next.children, c.MaxChildDepth) && withinLimit(next.parents+next.children, c.MaxDepth)
+}
+
+// Zero limit means the depth is not limited
+func withinLimit(hops, limit int) bool {
+	return limit <= 0 || hops <= limit
+}
+
+// Check whether the traversal can follow at least as much from this depth as from the other one
+func (d depth) within(other depth) bool {
+	return d.parents <= other.parents && d.children <= other.children
+}
+
+func (c *parserConfig) limitsDepth() bool {
+	return c.MaxDepth > 0 || c.MaxParentDepth > 0 || c.MaxChildDepth > 0
+}
+
+// Depths the records of a traversal were reached at. A record reached again through a path
+// with fewer hops of either kind is expanded again, as the depth limits may stop less of it.
+// Only the depths which aren't deeper than another one in both directions are kept.
+type depthSet struct {
+	mu     sync.Mutex
+	depths map[recordHash][]depth
+}
+
+func newDepthSet() *depthSet {
+	return &depthSet{depths: make(map[recordHash][]depth)}
+}
+
+// Mark the record as reached at the given depth, the result is false when it was already
+// reached at a depth the traversal can follow at least as much from
+func (s *depthSet) visit(hash recordHash, d depth) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.depths[hash][:0:0]
+	for _, reached := range s.depths[hash] {
+		if reached.within(d) {
+			return false
+		}
+		if !d.within(reached) {
+			kept = append(kept, reached)
+		}
+	}
+	s.depths[hash] = append(kept, d)
+	return true
+}
+
+func (s *depthSet) has(hash recordHash) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.depths[hash]
+	return ok
+}
+
+// Mark the record as reached at the given depth, see depthSet. Without depth limits every
+// record is expanded once, from the first path reaching it.
+func (p *Parser) visitRecord(hash recordHash, d depth) bool {
+	if !p.config.limitsDepth() {
+		d = depth{}
+	}
+	return p.visitedRecords.visit(hash, d)
+}
+
+// Record at the depth limit referencing a parent record which is not part of the graph,
+// the extracted graph can't be loaded without that parent
+type UnresolvedParent struct {
+	Record       Record
+	Relationship Relationship
+}
+
+// Keep the parent references which weren't followed because of the depth limits
+// and couldn't be resolved through any other path of the traversal
+func (p *Parser) resolveBoundary(set *recordSet) []UnresolvedParent {
+	var unresolved []UnresolvedParent
+	seen := make(map[string]bool)
+	for _, ref := range p.boundary {
+		key := ref.Record.Table.FullName() + encodeKey(ref.Record.primaryKey().Values) + ref.Relationship.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		fkValues, _ := ref.Record.valuesOf(ref.Relationship.SourceColumn)
+		if _, found := set.find(ref.Relationship.TargetTable, ref.Relationship.TargetColumn, fkValues); !found {
+			unresolved = append(unresolved, ref)
+		}
+	}
+	return unresolved
+}
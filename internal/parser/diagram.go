@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Cardinality markers of both ends of a relationship in crow's foot notation,
+// as written by Mermaid erDiagram
+type cardinality struct {
+	parent string
+	child  string
+}
+
+// Derive cardinality of the referenced (parent) and referencing (child) table from the relationship type
+func relationshipCardinality(rel Relationship) cardinality {
+	var c cardinality
+	switch rel.RelationType {
+	case OneToOne:
+		c = cardinality{parent: "||", child: "o|"}
+	case OneToMany:
+		c = cardinality{parent: "}o", child: "o|"}
+	case ManyToMany:
+		c = cardinality{parent: "}o", child: "o{"}
+	default:
+		c = cardinality{parent: "||", child: "o{"}
+	}
+	// A child with a nullable foreign key doesn't need a parent
+	if c.parent == "||" && isNullable(rel.SourceColumn) {
+		c.parent = "|o"
+	}
+	return c
+}
+
+// Graphviz arrow shapes drawing the same markers, the shape closest to the node comes first
+var dotArrows = map[string]string{
+	"||": "teetee",
+	"|o": "teeodot",
+	"}o": "crowodot",
+	"o|": "teeodot",
+	"o{": "crowodot",
+}
+
+// GenerateSchemaDiagram renders discovered tables and relationships as an
+// entity relationship diagram, either a Mermaid erDiagram or a Graphviz digraph
+func (p *Parser) GenerateSchemaDiagram(format OutputFormat) (string, error) {
+	tables := append(append([]Table(nil), p.TablesWithPrimaryKey...), p.TablesWithoutPrimaryKey...)
+
+	// Foreign key columns of every table
+	foreignKeys := make(map[string][]string)
+	for _, rel := range p.Relationships {
+		for _, col := range rel.SourceColumn {
+			foreignKeys[rel.SourceTable.FullName()] = append(foreignKeys[rel.SourceTable.FullName()], col.Name)
+		}
+	}
+
+	switch format {
+	case FormatMermaid:
+		return p.generateMermaidDiagram(tables, foreignKeys), nil
+	case FormatDOT:
+		return p.generateDOTDiagram(tables, foreignKeys), nil
+	default:
+		return "", fmt.Errorf("unsupported diagram format %q", format)
+	}
+}
+
+func (p *Parser) generateMermaidDiagram(tables []Table, foreignKeys map[string][]string) string {
+	var sb strings.Builder
+
+	sb.WriteString("erDiagram\n")
+	for _, table := range tables {
+		sb.WriteString(fmt.Sprintf("  %s[\"%s\"] {\n", diagramID(table), table.FullName()))
+		for _, col := range table.Columns {
+			var keys []string
+			if col.IsPrimary {
+				keys = append(keys, "PK")
+			}
+			if contains(foreignKeys[table.FullName()], col.Name) {
+				keys = append(keys, "FK")
+			}
+			sb.WriteString(fmt.Sprintf("    %s %s", diagramIdentifier.ReplaceAllString(col.DataType, "_"), col.Name))
+			if len(keys) > 0 {
+				sb.WriteString(" " + strings.Join(keys, ", "))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("  }\n")
+	}
+	for _, rel := range p.Relationships {
+		c := relationshipCardinality(rel)
+		// Non-identifying (dotted) line for relationships without a constraint
+		line := "--"
+		if rel.Virtual {
+			line = ".."
+		}
+		sb.WriteString(fmt.Sprintf("  %s %s%s%s %s : \"%s\"\n",
+			diagramID(rel.TargetTable), c.parent, line, c.child, diagramID(rel.SourceTable), mermaidEscape(relationshipColumnsLabel(rel))))
+	}
+
+	return sb.String()
+}
+
+func (p *Parser) generateDOTDiagram(tables []Table, foreignKeys map[string][]string) string {
+	var sb strings.Builder
+
+	sb.WriteString("digraph schema {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box];\n")
+	for _, table := range tables {
+		// Left aligned list of columns below the table name
+		label := dotEscaper.Replace(table.FullName()) + `\n\n`
+		for _, col := range table.Columns {
+			line := fmt.Sprintf("%s : %s", col.Name, col.DataType)
+			if col.IsPrimary {
+				line += " PK"
+			}
+			if contains(foreignKeys[table.FullName()], col.Name) {
+				line += " FK"
+			}
+			label += dotEscaper.Replace(line) + `\l`
+		}
+		sb.WriteString(fmt.Sprintf("  %s [label=\"%s\"];\n", dotQuote(table.FullName()), label))
+	}
+	for _, rel := range p.Relationships {
+		c := relationshipCardinality(rel)
+		style := ""
+		if rel.Virtual {
+			style = ", style=dashed"
+		}
+		sb.WriteString(fmt.Sprintf("  %s -> %s [label=%s, dir=both, arrowhead=%s, arrowtail=%s%s];\n",
+			dotQuote(rel.SourceTable.FullName()), dotQuote(rel.TargetTable.FullName()),
+			dotQuote(relationshipColumnsLabel(rel)), dotArrows[c.parent], dotArrows[c.child], style))
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// Characters Mermaid doesn't accept in entity names and attribute types
+var diagramIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Entity name of a table, the full name is shown as its alias
+func diagramID(table Table) string {
+	return diagramIdentifier.ReplaceAllString(table.FullName(), "_")
+}
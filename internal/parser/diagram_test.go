@@ -0,0 +1,75 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestGenerateSchemaDiagram(t *testing.T) {
+	users := parser.Table{Name: "users", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "manager_id", DataType: "integer", IsNullable: true},
+		{Name: "created_at", DataType: "timestamp with time zone"},
+	}}
+	profiles := parser.Table{Name: "profiles", Schema: "public", Columns: []parser.Column{
+		{Name: "user_id", DataType: "integer", IsPrimary: true},
+	}}
+	logs := parser.Table{Name: "logs", Schema: "public", Columns: []parser.Column{
+		{Name: "user_id", DataType: "integer"},
+	}}
+
+	p := &parser.Parser{
+		TablesWithPrimaryKey:    []parser.Table{users, profiles},
+		TablesWithoutPrimaryKey: []parser.Table{logs},
+		Relationships: []parser.Relationship{
+			{SourceTable: users, SourceColumn: users.Columns[1:2], TargetTable: users, TargetColumn: users.Columns[:1], RelationType: parser.SelfReferencing},
+			{SourceTable: profiles, SourceColumn: profiles.Columns, TargetTable: users, TargetColumn: users.Columns[:1], RelationType: parser.OneToOne},
+			{SourceTable: logs, SourceColumn: logs.Columns, TargetTable: users, TargetColumn: users.Columns[:1], RelationType: parser.ManyToOne},
+		},
+	}
+
+	t.Run("should generate mermaid er diagram", func(t *testing.T) {
+		out, err := p.GenerateSchemaDiagram(parser.FormatMermaid)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "erDiagram\n"+
+				"  public_users[\"public.users\"] {\n"+
+				"    integer id PK\n"+
+				"    integer manager_id FK\n"+
+				"    timestamp_with_time_zone created_at\n"+
+				"  }\n"+
+				"  public_profiles[\"public.profiles\"] {\n"+
+				"    integer user_id PK, FK\n"+
+				"  }\n"+
+				"  public_logs[\"public.logs\"] {\n"+
+				"    integer user_id FK\n"+
+				"  }\n"+
+				"  public_users |o--o{ public_users : \"manager_id -> id\"\n"+
+				"  public_users ||--o| public_profiles : \"user_id -> id\"\n"+
+				"  public_users ||--o{ public_logs : \"user_id -> id\"\n", out)
+		}
+	})
+
+	t.Run("should generate dot diagram", func(t *testing.T) {
+		out, err := p.GenerateSchemaDiagram(parser.FormatDOT)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "digraph schema {\n"+
+				"  rankdir=LR;\n"+
+				"  node [shape=box];\n"+
+				"  \"public.users\" [label=\"public.users\\n\\nid : integer PK\\lmanager_id : integer FK\\lcreated_at : timestamp with time zone\\l\"];\n"+
+				"  \"public.profiles\" [label=\"public.profiles\\n\\nuser_id : integer PK FK\\l\"];\n"+
+				"  \"public.logs\" [label=\"public.logs\\n\\nuser_id : integer FK\\l\"];\n"+
+				"  \"public.users\" -> \"public.users\" [label=\"manager_id -> id\", dir=both, arrowhead=teeodot, arrowtail=crowodot];\n"+
+				"  \"public.profiles\" -> \"public.users\" [label=\"user_id -> id\", dir=both, arrowhead=teetee, arrowtail=teeodot];\n"+
+				"  \"public.logs\" -> \"public.users\" [label=\"user_id -> id\", dir=both, arrowhead=teetee, arrowtail=crowodot];\n"+
+				"}\n", out)
+		}
+	})
+
+	t.Run("should reject formats other than diagrams", func(t *testing.T) {
+		_, err := p.GenerateSchemaDiagram(parser.FormatSQL)
+		assert.Error(t, err)
+	})
+}
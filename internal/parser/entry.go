@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SelectEntryKeys gets primary keys of the rows of the table matching the given SQL predicate
+func (p *Parser) SelectEntryKeys(ctx context.Context, table Table, where string) ([]PrimaryKey, error) {
+	return p.QueryEntryKeys(ctx, table, fmt.Sprintf("SELECT * FROM %s WHERE %s", table.FullName(), where))
+}
+
+// QueryEntryKeys gets primary keys of the table from the rows of an arbitrary query,
+// which has to return the primary key columns of the table by their names.
+// The query reads from the snapshot started by BeginSnapshot if there is one.
+func (p *Parser) QueryEntryKeys(ctx context.Context, table Table, query string) ([]PrimaryKey, error) {
+	pkColumns, ok := p.TableToPKColumnsMap[table.FullName()]
+	if !ok {
+		return nil, fmt.Errorf("%w for table %s", ErrNoPrimaryKeyFound, table.FullName())
+	}
+
+	// Read the keys the same way records are read, so they compare equal to keys of fetched records
+	orderBy := make([]string, len(pkColumns))
+	for i, col := range pkColumns {
+		orderBy[i] = col.Name
+	}
+	wrapped := fmt.Sprintf("SELECT DISTINCT %s FROM (%s) AS entries ORDER BY %s",
+		p.buildSelectColumnsQueryPart(pkColumns), query, strings.Join(orderBy, ", "))
+
+	rows, err := p.querier().Query(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entry records: %w", err)
+	}
+	defer rows.Close()
+
+	var pks []PrimaryKey
+	for rows.Next() {
+		values := make([]interface{}, len(pkColumns))
+		valuePtrs := make([]interface{}, len(values))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan entry key: %w", err)
+		}
+		pks = append(pks, PrimaryKey{Columns: pkColumns, Values: values})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating entry keys: %w", err)
+	}
+
+	return pks, nil
+}
@@ -7,4 +7,6 @@ var (
 	ErrNoRelationshipsFound = fmt.Errorf("no relationships found")
 	ErrNoPrimaryKeyFound    = fmt.Errorf("no primary key found")
 	ErrRecordAlreadyVisited = fmt.Errorf("record already visited")
+	ErrNoEntryRecords       = fmt.Errorf("no entry records")
+	ErrNoSequencePool       = fmt.Errorf("sequence key remapping needs the database the records are loaded into")
 )
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Why children of a record were left out of the graph
+type TruncationReason string
+
+const (
+	// Children not matching the row filter of their table
+	TruncatedByFilter TruncationReason = "row filter"
+	// Children beyond the limit of a relationship rule
+	TruncatedByLimit TruncationReason = "limit"
+)
+
+// Children of a parent record which were partly left out of the graph
+type Truncation struct {
+	Relationship Relationship
+	// Values of the referenced columns of the parent record
+	ParentKey []interface{}
+	Reason    TruncationReason
+}
+
+// LoadRowFilters reads SQL predicates keyed by `table` or `schema.table` from a YAML or JSON file
+func LoadRowFilters(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var filters map[string]string
+	if err := yaml.Unmarshal(data, &filters); err != nil {
+		return nil, fmt.Errorf("failed to decode row filters: %w", err)
+	}
+	if err := ValidateRowFilters(filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+// ValidateRowFilters checks that every filter names a table and has a predicate
+func ValidateRowFilters(filters map[string]string) error {
+	for table, predicate := range filters {
+		if strings.TrimSpace(table) == "" {
+			return fmt.Errorf("row filter without a table")
+		}
+		if strings.TrimSpace(predicate) == "" {
+			return fmt.Errorf("row filter of table %s is empty", table)
+		}
+	}
+	return nil
+}
+
+// Get the row filter of the table, a filter of `schema.table` wins over one of `table`
+func (c *parserConfig) rowFilter(table Table) string {
+	if filter, ok := c.RowFilters[table.FullName()]; ok {
+		return filter
+	}
+	return c.RowFilters[table.Name]
+}
+
+// Get the maximum number of children followed through the relationship and their order,
+// the last matching rule setting either of them wins
+func (c *parserConfig) childLimit(rel Relationship) (int, string) {
+	limit, orderBy := 0, ""
+	for _, rule := range c.rules {
+		if (rule.Limit > 0 || rule.OrderBy != "") && rule.pattern.matches(rel) {
+			if rule.Limit > 0 {
+				limit = rule.Limit
+			}
+			if rule.OrderBy != "" {
+				orderBy = rule.OrderBy
+			}
+		}
+	}
+	return limit, orderBy
+}
+
+// Get the tables of the given truncations with the reasons they were truncated for, sorted by table name
+func truncatedTables(truncations []Truncation) ([]string, map[string][]TruncationReason) {
+	var tables []string
+	reasons := make(map[string][]TruncationReason)
+	for _, t := range truncations {
+		table := t.Relationship.SourceTable.FullName()
+		if _, ok := reasons[table]; !ok {
+			tables = append(tables, table)
+		}
+		if !containsReason(reasons[table], t.Reason) {
+			reasons[table] = append(reasons[table], t.Reason)
+		}
+	}
+	sort.Strings(tables)
+	return tables, reasons
+}
+
+func containsReason(reasons []TruncationReason, reason TruncationReason) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe the truncated tables as SQL comments, so the output tells it is not complete
+func truncationComments(truncations []Truncation) string {
+	tables, reasons := truncatedTables(truncations)
+	var sb strings.Builder
+	for _, table := range tables {
+		names := make([]string, len(reasons[table]))
+		for i, reason := range reasons[table] {
+			names[i] = string(reason)
+		}
+		sb.WriteString(fmt.Sprintf("-- rows of %s truncated by %s\n", table, strings.Join(names, ", ")))
+	}
+	return sb.String()
+}
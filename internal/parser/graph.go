@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Edge links a child record of a graph to the parent record it references
+type Edge struct {
+	Relationship Relationship
+	// Positions of the child and the parent record in the graph
+	Child  int
+	Parent int
+}
+
+// Find links between records of a graph along the relationships which were
+// followed while traversing it
+func (p *Parser) followedEdges(records []Record) []Edge {
+	var edges []Edge
+	for _, dep := range p.recordDependencies(records) {
+		rel := dep.relationship
+		if !p.hasRelationshipVisit(rel.SourceTable, rel.TargetTable) && !p.hasRelationshipVisit(rel.TargetTable, rel.SourceTable) {
+			continue
+		}
+		edges = append(edges, Edge{Relationship: rel, Child: dep.child, Parent: dep.parent})
+	}
+	return edges
+}
+
+// GenerateDOT generates a Graphviz digraph with a node per record and an edge
+// from every child record to the parent record it references
+func (p *Parser) GenerateDOT(ctx context.Context, records []Record, edges []Edge) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString("digraph records {\n")
+	sb.WriteString("  node [shape=box];\n")
+	for i, record := range records {
+		sb.WriteString(fmt.Sprintf("  r%d [label=%s];\n", i, dotQuote(record.Table.FullName()+"\n"+recordKeyLabel(record))))
+	}
+	for _, edge := range edges {
+		sb.WriteString(fmt.Sprintf("  r%d -> r%d [label=%s];\n", edge.Child, edge.Parent, dotQuote(edgeLabel(edge))))
+	}
+	sb.WriteString("}\n")
+
+	return sb.String(), nil
+}
+
+// GenerateMermaid generates a Mermaid flowchart with a node per record and an
+// edge from every child record to the parent record it references
+func (p *Parser) GenerateMermaid(ctx context.Context, records []Record, edges []Edge) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString("flowchart LR\n")
+	for i, record := range records {
+		sb.WriteString(fmt.Sprintf("  r%d[\"%s<br/>%s\"]\n", i, mermaidEscape(record.Table.FullName()), mermaidEscape(recordKeyLabel(record))))
+	}
+	for _, edge := range edges {
+		sb.WriteString(fmt.Sprintf("  r%d -->|\"%s\"| r%d\n", edge.Child, mermaidEscape(edgeLabel(edge)), edge.Parent))
+	}
+
+	return sb.String(), nil
+}
+
+// Describe a record by its primary key, e.g. `tenant_id=1, id=2`
+func recordKeyLabel(record Record) string {
+	pk := record.primaryKey()
+	if len(pk.Columns) == 0 {
+		return "(no primary key)"
+	}
+	pairs := make([]string, len(pk.Columns))
+	for i, col := range pk.Columns {
+		pairs[i] = fmt.Sprintf("%s=%v", col.Name, pk.Values[i])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// Describe an edge by its relationship columns and type, e.g. `user_id -> id (many-to-one)`
+func edgeLabel(edge Edge) string {
+	return fmt.Sprintf("%s (%s)", relationshipColumnsLabel(edge.Relationship), edge.Relationship.RelationType)
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Quote a string as a DOT identifier
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "\n", " ")
+
+// Escape text of a quoted Mermaid label
+func mermaidEscape(s string) string {
+	return mermaidEscaper.Replace(s)
+}
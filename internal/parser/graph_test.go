@@ -0,0 +1,80 @@
+package parser_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestGenerateRecordGraph(t *testing.T) {
+	ctx := context.Background()
+
+	tenants := parser.Table{Name: "tenants", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "name", DataType: "text"},
+	}}
+	orders := parser.Table{Name: "orders", Schema: "public", Columns: []parser.Column{
+		{Name: "tenant_id", DataType: "integer", IsPrimary: true},
+		{Name: "id", DataType: "integer", IsPrimary: true},
+	}}
+	lines := parser.Table{Name: "order_lines", Schema: "public", Columns: []parser.Column{
+		{Name: "tenant_id", DataType: "integer"},
+		{Name: "order_id", DataType: "integer"},
+		{Name: "note", DataType: "text"},
+	}}
+
+	records := []parser.Record{
+		{Table: tenants, Columns: tenants.Columns, Values: []interface{}{int32(1), `Acme "Inc"`}},
+		{Table: orders, Columns: orders.Columns, Values: []interface{}{int32(1), int32(7)}},
+		{Table: lines, Columns: lines.Columns, Values: []interface{}{int32(1), int32(7), "first"}},
+	}
+	edges := []parser.Edge{
+		{
+			Relationship: parser.Relationship{
+				SourceTable: orders, SourceColumn: orders.Columns[:1],
+				TargetTable: tenants, TargetColumn: tenants.Columns[:1],
+				RelationType: parser.ManyToOne,
+			},
+			Child: 1, Parent: 0,
+		},
+		{
+			Relationship: parser.Relationship{
+				SourceTable: lines, SourceColumn: lines.Columns[:2],
+				TargetTable: orders, TargetColumn: orders.Columns,
+				RelationType: parser.ManyToOne,
+			},
+			Child: 2, Parent: 1,
+		},
+	}
+
+	p := &parser.Parser{}
+
+	t.Run("should generate dot graph", func(t *testing.T) {
+		out, err := p.GenerateDOT(ctx, records, edges)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "digraph records {\n"+
+				"  node [shape=box];\n"+
+				"  r0 [label=\"public.tenants\\nid=1\"];\n"+
+				"  r1 [label=\"public.orders\\ntenant_id=1, id=7\"];\n"+
+				"  r2 [label=\"public.order_lines\\n(no primary key)\"];\n"+
+				"  r1 -> r0 [label=\"tenant_id -> id (many-to-one)\"];\n"+
+				"  r2 -> r1 [label=\"tenant_id, order_id -> tenant_id, id (many-to-one)\"];\n"+
+				"}\n", out)
+		}
+	})
+
+	t.Run("should generate mermaid flowchart", func(t *testing.T) {
+		out, err := p.GenerateMermaid(ctx, records, edges)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "flowchart LR\n"+
+				"  r0[\"public.tenants<br/>id=1\"]\n"+
+				"  r1[\"public.orders<br/>tenant_id=1, id=7\"]\n"+
+				"  r2[\"public.order_lines<br/>(no primary key)\"]\n"+
+				"  r1 -->|\"tenant_id -> id (many-to-one)\"| r0\n"+
+				"  r2 -->|\"tenant_id, order_id -> tenant_id, id (many-to-one)\"| r1\n", out)
+		}
+	})
+}
@@ -1,5 +1,11 @@
 package parser
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Helper to check if a slice contains a string
 func contains(slice []string, str string) bool {
 	for _, s := range slice {
@@ -9,3 +15,17 @@ func contains(slice []string, str string) bool {
 	}
 	return false
 }
+
+// Helper to encode a list of key values into a string usable as a map key,
+// values are compared by their text representation so that the same key
+// scanned into different integer types still matches
+func encodeKey(values []interface{}) string {
+	var sb strings.Builder
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Quote(fmt.Sprint(v)))
+	}
+	return sb.String()
+}
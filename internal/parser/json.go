@@ -0,0 +1,218 @@
+package parser
+
+import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Graph of records as written by the JSON output format
+type jsonGraph struct {
+	Records   []jsonRecord     `json:"records"`
+	Edges     []jsonEdge       `json:"edges"`
+	Truncated []jsonTruncation `json:"truncated,omitempty"`
+}
+
+// Record as written by the JSON output formats, kind is only set in NDJSON
+// where records and edges share the same stream
+type jsonRecord struct {
+	Kind       string                 `json:"kind,omitempty"`
+	Table      string                 `json:"table"`
+	Schema     string                 `json:"schema"`
+	PrimaryKey map[string]interface{} `json:"primary_key"`
+	Columns    map[string]interface{} `json:"columns"`
+}
+
+// Edge as written by the JSON output formats, child and parent are positions of records in the output
+type jsonEdge struct {
+	Kind          string       `json:"kind,omitempty"`
+	Relationship  string       `json:"relationship"`
+	RelationType  RelationType `json:"relation_type"`
+	Child         int          `json:"child"`
+	Parent        int          `json:"parent"`
+	ChildColumns  []string     `json:"child_columns"`
+	ParentColumns []string     `json:"parent_columns"`
+}
+
+// Children of a parent record left out of the graph by a row filter or a limit
+type jsonTruncation struct {
+	Kind         string                 `json:"kind,omitempty"`
+	Table        string                 `json:"table"`
+	Schema       string                 `json:"schema"`
+	Relationship string                 `json:"relationship"`
+	ParentTable  string                 `json:"parent_table"`
+	ParentKey    map[string]interface{} `json:"parent_key"`
+	Reason       TruncationReason       `json:"reason"`
+}
+
+// GenerateJSON generates a JSON document with the given records and the edges between them
+func (p *Parser) GenerateJSON(ctx context.Context, records []Record, edges []Edge) (string, error) {
+	graph := jsonGraph{
+		Records: make([]jsonRecord, len(records)),
+		Edges:   make([]jsonEdge, len(edges)),
+	}
+	for i, record := range records {
+		graph.Records[i] = p.jsonRecord(record)
+	}
+	for i, edge := range edges {
+		graph.Edges[i] = newJSONEdge(edge)
+	}
+	for _, t := range p.Truncations {
+		graph.Truncated = append(graph.Truncated, p.jsonTruncation(t))
+	}
+
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(graph); err != nil {
+		return "", fmt.Errorf("failed to encode graph: %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+// GenerateNDJSON generates one JSON object per line for every record followed by one per edge
+// and one per truncation, records are distinguished from edges and truncations by their kind
+func (p *Parser) GenerateNDJSON(ctx context.Context, records []Record, edges []Edge) (string, error) {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+
+	for _, record := range records {
+		line := p.jsonRecord(record)
+		line.Kind = "record"
+		if err := encoder.Encode(line); err != nil {
+			return "", fmt.Errorf("failed to encode record of %s: %w", record.Table.FullName(), err)
+		}
+	}
+	for _, edge := range edges {
+		line := newJSONEdge(edge)
+		line.Kind = "edge"
+		if err := encoder.Encode(line); err != nil {
+			return "", fmt.Errorf("failed to encode edge %s: %w", edge.Relationship.Name, err)
+		}
+	}
+	for _, t := range p.Truncations {
+		line := p.jsonTruncation(t)
+		line.Kind = "truncation"
+		if err := encoder.Encode(line); err != nil {
+			return "", fmt.Errorf("failed to encode truncation of %s: %w", t.Relationship.SourceTable.FullName(), err)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func (p *Parser) jsonRecord(record Record) jsonRecord {
+	out := jsonRecord{
+		Table:   record.Table.Name,
+		Schema:  record.Table.Schema,
+		Columns: make(map[string]interface{}, len(record.Columns)),
+	}
+	for i, col := range record.Columns {
+		value := p.jsonValue(col, record.Values[i])
+		out.Columns[col.Name] = value
+		if col.IsPrimary {
+			if out.PrimaryKey == nil {
+				out.PrimaryKey = make(map[string]interface{})
+			}
+			out.PrimaryKey[col.Name] = value
+		}
+	}
+	return out
+}
+
+func newJSONEdge(edge Edge) jsonEdge {
+	out := jsonEdge{
+		Relationship:  edge.Relationship.Name,
+		RelationType:  edge.Relationship.RelationType,
+		Child:         edge.Child,
+		Parent:        edge.Parent,
+		ChildColumns:  make([]string, len(edge.Relationship.SourceColumn)),
+		ParentColumns: make([]string, len(edge.Relationship.TargetColumn)),
+	}
+	for i, col := range edge.Relationship.SourceColumn {
+		out.ChildColumns[i] = col.Name
+	}
+	for i, col := range edge.Relationship.TargetColumn {
+		out.ParentColumns[i] = col.Name
+	}
+	return out
+}
+
+func (p *Parser) jsonTruncation(t Truncation) jsonTruncation {
+	out := jsonTruncation{
+		Table:        t.Relationship.SourceTable.Name,
+		Schema:       t.Relationship.SourceTable.Schema,
+		Relationship: t.Relationship.Name,
+		ParentTable:  t.Relationship.TargetTable.FullName(),
+		ParentKey:    make(map[string]interface{}, len(t.ParentKey)),
+		Reason:       t.Reason,
+	}
+	for i, col := range t.Relationship.TargetColumn {
+		if i < len(t.ParentKey) {
+			out.ParentKey[col.Name] = p.jsonValue(col, t.ParentKey[i])
+		}
+	}
+	return out
+}
+
+// Convert a scanned value into a value encoding/json writes without losing
+// precision: numerics become exact JSON numbers, timestamps RFC 3339 strings,
+// bytea base64 strings and JSON columns are embedded as they are
+func (p *Parser) jsonValue(col Column, val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		if (col.DataType == "json" || col.DataType == "jsonb") && json.Valid([]byte(v)) {
+			return json.RawMessage(v)
+		}
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case int16, int32, int, int64, bool:
+		return v
+	case float32:
+		return jsonFloat(float64(v))
+	case float64:
+		return jsonFloat(v)
+	case pgtype.Numeric:
+		text, err := v.Value()
+		if err != nil || text == nil {
+			return nil
+		}
+		// NaN and infinities have no JSON number representation
+		if v.NaN || v.InfinityModifier != pgtype.Finite {
+			return text
+		}
+		return json.Number(text.(string))
+	case pgtype.Time:
+		return formatPgTime(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]interface{}, []interface{}:
+		return v
+	case json.Marshaler, encoding.TextMarshaler:
+		return v
+	default:
+		p.logger.Printf("Unknown type: %T\n", v)
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return f
+}
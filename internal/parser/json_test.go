@@ -0,0 +1,120 @@
+package parser_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestGenerateJSON(t *testing.T) {
+	ctx := context.Background()
+
+	users := parser.Table{Name: "users", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "name", DataType: "text"},
+		{Name: "avatar", DataType: "bytea", IsNullable: true},
+		{Name: "settings", DataType: "jsonb", IsNullable: true},
+		{Name: "created_at", DataType: "timestamp with time zone"},
+	}}
+	orders := parser.Table{Name: "orders", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "user_id", DataType: "integer"},
+		{Name: "amount", DataType: "numeric"},
+	}}
+	rel := parser.Relationship{
+		Name:         "orders_user_id_fkey",
+		SourceTable:  orders,
+		SourceColumn: orders.Columns[1:2],
+		TargetTable:  users,
+		TargetColumn: users.Columns[:1],
+		RelationType: parser.ManyToOne,
+	}
+
+	records := []parser.Record{
+		{Table: users, Columns: users.Columns, Values: []interface{}{
+			int32(1), "John <Doe>", []byte("hi"), `{"theme": "dark"}`, time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC),
+		}},
+		{Table: orders, Columns: orders.Columns, Values: []interface{}{
+			int32(1), int32(1), pgtype.Numeric{Int: big.NewInt(1999), Exp: -2, Valid: true},
+		}},
+	}
+	edges := []parser.Edge{{Relationship: rel, Child: 1, Parent: 0}}
+
+	p := &parser.Parser{}
+
+	t.Run("should generate json document", func(t *testing.T) {
+		out, err := p.GenerateJSON(ctx, records, edges)
+		if assert.NoError(t, err) {
+			assert.JSONEq(t, `{
+				"records": [
+					{
+						"table": "users",
+						"schema": "public",
+						"primary_key": {"id": 1},
+						"columns": {
+							"id": 1,
+							"name": "John <Doe>",
+							"avatar": "aGk=",
+							"settings": {"theme": "dark"},
+							"created_at": "2024-01-02T03:04:05.0000006Z"
+						}
+					},
+					{
+						"table": "orders",
+						"schema": "public",
+						"primary_key": {"id": 1},
+						"columns": {"id": 1, "user_id": 1, "amount": 19.99}
+					}
+				],
+				"edges": [
+					{
+						"relationship": "orders_user_id_fkey",
+						"relation_type": "many-to-one",
+						"child": 1,
+						"parent": 0,
+						"child_columns": ["user_id"],
+						"parent_columns": ["id"]
+					}
+				]
+			}`, out)
+		}
+	})
+
+	t.Run("should generate one json object per line", func(t *testing.T) {
+		out, err := p.GenerateNDJSON(ctx, records, edges)
+		if assert.NoError(t, err) {
+			assert.Equal(t,
+				`{"kind":"record","table":"users","schema":"public","primary_key":{"id":1},"columns":{"avatar":"aGk=","created_at":"2024-01-02T03:04:05.0000006Z","id":1,"name":"John <Doe>","settings":{"theme":"dark"}}}`+"\n"+
+					`{"kind":"record","table":"orders","schema":"public","primary_key":{"id":1},"columns":{"amount":19.99,"id":1,"user_id":1}}`+"\n"+
+					`{"kind":"edge","relationship":"orders_user_id_fkey","relation_type":"many-to-one","child":1,"parent":0,"child_columns":["user_id"],"parent_columns":["id"]}`+"\n",
+				out)
+		}
+	})
+
+	t.Run("should list truncated children", func(t *testing.T) {
+		p := &parser.Parser{Truncations: []parser.Truncation{
+			{Relationship: rel, ParentKey: []interface{}{int32(1)}, Reason: parser.TruncatedByLimit},
+		}}
+		out, err := p.GenerateNDJSON(ctx, records[:1], nil)
+		if assert.NoError(t, err) {
+			assert.Contains(t, out,
+				`{"kind":"truncation","table":"orders","schema":"public","relationship":"orders_user_id_fkey","parent_table":"public.users","parent_key":{"id":1},"reason":"limit"}`+"\n")
+		}
+	})
+
+	t.Run("should keep exact numeric values", func(t *testing.T) {
+		record := parser.Record{Table: orders, Columns: orders.Columns, Values: []interface{}{
+			int32(2), int32(1), pgtype.Numeric{Int: big.NewInt(12345678901234567), Exp: -4, Valid: true},
+		}}
+		out, err := p.GenerateNDJSON(ctx, []parser.Record{record}, nil)
+		if assert.NoError(t, err) {
+			assert.Contains(t, out, `"amount":1234567890123.4567`)
+		}
+	})
+}
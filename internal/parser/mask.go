@@ -0,0 +1,408 @@
+package parser
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// How the values of a masked column are replaced
+type MaskStrategy string
+
+const (
+	// The value of the rule
+	MaskFixed MaskStrategy = "fixed"
+	// NULL
+	MaskNull MaskStrategy = "null"
+	// Hash of the value, integers are permuted among integers of the narrowest type holding them
+	// and strings replaced by the hex digest
+	MaskHash MaskStrategy = "hash"
+	// Fake email address
+	MaskEmail MaskStrategy = "email"
+	// Fake full name
+	MaskName MaskStrategy = "name"
+	// Fake phone number
+	MaskPhone MaskStrategy = "phone"
+	// Every character but the last ones replaced with an asterisk
+	MaskPartial MaskStrategy = "partial"
+)
+
+// Number of trailing characters kept by partial masking when the rule doesn't set it
+const defaultPartialKeep = 4
+
+// Rule masking the values of a column before they are written.
+//
+// Masking is deterministic, the same value always maps to the same masked value,
+// so masked keys still match across tables. NULL values are kept as they are.
+type MaskingRule struct {
+	// Masked column as `table.column` or `schema.table.column`
+	Column   string       `yaml:"column"`
+	Strategy MaskStrategy `yaml:"strategy"`
+	// Replacement of the fixed strategy
+	Value string `yaml:"value"`
+	// Number of trailing characters kept by the partial strategy
+	Keep int `yaml:"keep"`
+}
+
+// Validate checks that the rule names a column and a known strategy
+func (r MaskingRule) Validate() error {
+	if parts := strings.Split(r.Column, "."); len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("column %q must be table.column or schema.table.column", r.Column)
+	}
+	switch r.Strategy {
+	case MaskFixed, MaskNull, MaskHash, MaskEmail, MaskName, MaskPhone, MaskPartial:
+	default:
+		return fmt.Errorf("unknown masking strategy %q of column %s", r.Strategy, r.Column)
+	}
+	if r.Keep < 0 {
+		return fmt.Errorf("keep of column %s is negative", r.Column)
+	}
+	return nil
+}
+
+// LoadMaskingRules reads a list of masking rules from a YAML or JSON file
+func LoadMaskingRules(file string) ([]MaskingRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []MaskingRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode masking rules: %w", err)
+	}
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("masking rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// Mask replaces the value according to the strategy of the rule, the salt
+// keeps masked values from being looked up by hashing known values
+func (r MaskingRule) Mask(value interface{}, salt string) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch r.Strategy {
+	case MaskNull:
+		return nil
+	case MaskFixed:
+		return r.Value
+	case MaskHash:
+		return maskHash(value, salt)
+	case MaskEmail:
+		return fmt.Sprintf("user_%s@example.com", hex.EncodeToString(maskDigest(value, salt)[:8]))
+	case MaskName:
+		digest := maskDigest(value, salt)
+		first := fakeFirstNames[int(digest[0])%len(fakeFirstNames)]
+		last := fakeLastNames[int(digest[1])%len(fakeLastNames)]
+		return first + " " + last
+	case MaskPhone:
+		n := binary.BigEndian.Uint32(maskDigest(value, salt)) % 10000000
+		return fmt.Sprintf("555-%03d-%04d", n/10000, n%10000)
+	case MaskPartial:
+		keep := r.Keep
+		if keep == 0 {
+			keep = defaultPartialKeep
+		}
+		runes := []rune(fmt.Sprint(value))
+		if keep > len(runes) {
+			keep = len(runes)
+		}
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	default:
+		return value
+	}
+}
+
+// Digest of the value only, not of its column, so a key and the foreign keys
+// referencing it are masked to the same value
+func maskDigest(value interface{}, salt string) []byte {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(fmt.Sprint(value)))
+	return mac.Sum(nil)
+}
+
+// Hash the value into a value of the same type, so it still fits its column. Integers are permuted
+// rather than reduced, so different keys never collide, and strings get the whole digest.
+func maskHash(value interface{}, salt string) interface{} {
+	switch v := value.(type) {
+	case int16:
+		return int16(permuteInt(int64(v), salt))
+	case int32:
+		return int32(permuteInt(int64(v), salt))
+	case int64:
+		return permuteInt(v, salt)
+	case int:
+		return int(permuteInt(int64(v), salt))
+	default:
+		return hex.EncodeToString(maskDigest(value, salt))
+	}
+}
+
+// Bit sizes of the integer types, a value is permuted among the values of the narrowest one holding it
+// and not among those of narrower ones. The masked value then fits every column the value fits, and
+// keys held by columns of different integer types, as a bigint referencing an integer, still match.
+var permutationBits = []uint{16, 32, 64}
+
+// Map an integer to another one, one to one. Positive values are permuted among positive values
+// and negative among negative ones, zero stays zero.
+func permuteInt(v int64, salt string) int64 {
+	switch {
+	case v > 0:
+		return int64(permuteOffset(uint64(v-1), 1, salt)) + 1
+	case v < 0:
+		return ^int64(permuteOffset(uint64(^v), 0, salt))
+	default:
+		return 0
+	}
+}
+
+// Permute the distance of a value from zero among the distances of values of the same bit size,
+// positive values having one distance less than negative ones in every size
+func permuteOffset(x, positive uint64, salt string) uint64 {
+	var low uint64
+	for _, bits := range permutationBits {
+		high := uint64(1)<<(bits-1) - 1 - positive
+		if x <= high {
+			return walkPermutation(x, low, high, bits, salt)
+		}
+		low = high + 1
+	}
+	return x
+}
+
+// Permute x within [low, high] by applying the permutation of [0, 2^bits) until the result is
+// in range, which keeps it one to one
+func walkPermutation(x, low, high uint64, bits uint, salt string) uint64 {
+	for {
+		x = feistel(x, bits, salt)
+		if x >= low && x <= high {
+			return x
+		}
+	}
+}
+
+// Permute x within [0, 2^bits) with a Feistel network keyed by the salt, bits is even
+func feistel(x uint64, bits uint, salt string) uint64 {
+	half := bits / 2
+	mask := uint64(1)<<half - 1
+	left, right := x>>half, x&mask
+	for round := byte(0); round < 4; round++ {
+		mac := hmac.New(sha256.New, []byte(salt))
+		msg := binary.BigEndian.AppendUint64([]byte{round}, right)
+		mac.Write(msg)
+		left, right = right, left^(binary.BigEndian.Uint64(mac.Sum(nil))&mask)
+	}
+	return left<<half | right
+}
+
+var fakeFirstNames = []string{
+	"Alex", "Blake", "Casey", "Dana", "Drew", "Emery", "Finley", "Harper",
+	"Jamie", "Jordan", "Kai", "Logan", "Morgan", "Parker", "Quinn", "Riley",
+	"Robin", "Rowan", "Sage", "Sam", "Skyler", "Taylor", "Val", "Avery",
+}
+
+var fakeLastNames = []string{
+	"Adams", "Baker", "Carter", "Davis", "Ellis", "Foster", "Garcia", "Hughes",
+	"Irving", "Jensen", "Keller", "Lopez", "Miller", "Nolan", "Owens", "Patel",
+	"Reed", "Silva", "Turner", "Usman", "Vance", "Walker", "Young", "Zimmer",
+}
+
+// Check that every masking rule names a discovered column, a typo must not let values through unmasked
+func (p *Parser) checkMaskingRules() error {
+	for _, rule := range p.config.MaskingRules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		i := strings.LastIndex(rule.Column, ".")
+		tableName, columnName := rule.Column[:i], rule.Column[i+1:]
+		if p.isTableFiltered(tableName) {
+			continue
+		}
+		table, err := p.findTable(tableName)
+		if err != nil {
+			return fmt.Errorf("masking rule of column %s: %w", rule.Column, err)
+		}
+		if _, err := pickColumns(table, []string{columnName}); err != nil {
+			return fmt.Errorf("masking rule of column %s: %w", rule.Column, err)
+		}
+	}
+
+	// Rules also apply to the foreign keys referencing their column, so every masked column is checked
+	masks := p.columnMasks()
+	for _, table := range append(append([]Table(nil), p.TablesWithPrimaryKey...), p.TablesWithoutPrimaryKey...) {
+		for _, col := range table.Columns {
+			rule, ok := masks[columnKey(table, col)]
+			if !ok {
+				continue
+			}
+			maxLength := p.TableToColumnLengthsMap[table.FullName()][col.Name]
+			if err := checkMaskedColumn(rule, col, p.isUniqueColumn(table, col), maxLength); err != nil {
+				return fmt.Errorf("masking rule of column %s applied to %s: %w", rule.Column, columnKey(table, col), err)
+			}
+		}
+	}
+	return nil
+}
+
+// Data types masked values of text strategies can be written to
+var textDataTypes = map[string]bool{
+	"text":              true,
+	"character varying": true,
+	"character":         true,
+}
+
+// Check that masked values fit the column, and that masked values of a unique column
+// stay unique so the extracted records can still be inserted. A zero maxLength means
+// the length of the column isn't limited.
+func checkMaskedColumn(rule MaskingRule, col Column, unique bool, maxLength int) error {
+	switch rule.Strategy {
+	case MaskEmail, MaskName, MaskPhone, MaskPartial:
+		if !textDataTypes[col.DataType] {
+			return fmt.Errorf("%s masking only applies to text columns, not %s", rule.Strategy, col.DataType)
+		}
+	case MaskHash:
+		if !textDataTypes[col.DataType] && !integerDataTypes[col.DataType] {
+			return fmt.Errorf("hash masking only applies to integer and text columns, not %s", col.DataType)
+		}
+	case MaskNull:
+		if col.IsPrimary || !col.IsNullable {
+			return fmt.Errorf("null masking doesn't apply to primary key or NOT NULL columns")
+		}
+	}
+	if length := maskedLength(rule); maxLength > 0 && textDataTypes[col.DataType] && length > maxLength {
+		return fmt.Errorf("%s masking writes up to %d characters, more than the %d of the column", rule.Strategy, length, maxLength)
+	}
+	if unique {
+		switch rule.Strategy {
+		case MaskFixed, MaskName, MaskPhone, MaskPartial:
+			return fmt.Errorf("%s masking can give different values of a unique column the same value", rule.Strategy)
+		}
+	}
+	return nil
+}
+
+// Maximum number of characters of the text values the rule masks to, zero when
+// masked values are no longer than the values they replace
+func maskedLength(rule MaskingRule) int {
+	switch rule.Strategy {
+	case MaskFixed:
+		return len([]rune(rule.Value))
+	case MaskHash:
+		return hex.EncodedLen(sha256.Size)
+	case MaskEmail:
+		return len("user_@example.com") + hex.EncodedLen(8)
+	case MaskName:
+		return longestName(fakeFirstNames) + 1 + longestName(fakeLastNames)
+	case MaskPhone:
+		return len("555-000-0000")
+	default:
+		return 0
+	}
+}
+
+func longestName(names []string) int {
+	longest := 0
+	for _, name := range names {
+		longest = max(longest, len(name))
+	}
+	return longest
+}
+
+// Check whether the column alone is a primary key or unique index of the table, a column
+// which is only part of a wider key may hold the same value in several rows
+func (p *Parser) isUniqueColumn(table Table, col Column) bool {
+	for _, key := range p.TableToUniqueKeysMap[table.FullName()] {
+		if len(key) == 1 && key[0] == col.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve the masking rules by column, a rule of a referenced column also applies
+// to the foreign key columns referencing it unless they have their own rule
+func (p *Parser) columnMasks() map[string]MaskingRule {
+	masks := make(map[string]MaskingRule)
+	if len(p.config.MaskingRules) == 0 {
+		return masks
+	}
+
+	for _, table := range append(append([]Table(nil), p.TablesWithPrimaryKey...), p.TablesWithoutPrimaryKey...) {
+		for _, col := range table.Columns {
+			// A rule of `schema.table.column` wins over one of `table.column`
+			for _, rule := range p.config.MaskingRules {
+				if rule.Column == table.Name+"."+col.Name {
+					masks[columnKey(table, col)] = rule
+				}
+			}
+			for _, rule := range p.config.MaskingRules {
+				if rule.Column == table.FullName()+"."+col.Name {
+					masks[columnKey(table, col)] = rule
+				}
+			}
+		}
+	}
+
+	// Propagate rules along relationships until chains of foreign keys are covered
+	for changed := true; changed; {
+		changed = false
+		for _, rel := range p.Relationships {
+			for i, target := range rel.TargetColumn {
+				rule, ok := masks[columnKey(rel.TargetTable, target)]
+				source := columnKey(rel.SourceTable, rel.SourceColumn[i])
+				if _, masked := masks[source]; ok && !masked {
+					masks[source] = rule
+					changed = true
+				}
+			}
+		}
+	}
+	return masks
+}
+
+// Key of a column unique across schemas
+func columnKey(table Table, col Column) string {
+	return table.FullName() + "." + col.Name
+}
+
+// Mask values of the given columns of the table, the values are copied
+func (p *Parser) maskValues(masks map[string]MaskingRule, table Table, columns []Column, values []interface{}) []interface{} {
+	masked := make([]interface{}, len(values))
+	for i, val := range values {
+		if rule, ok := masks[columnKey(table, columns[i])]; ok {
+			val = rule.Mask(val, p.config.MaskingSalt)
+		}
+		masked[i] = val
+	}
+	return masked
+}
+
+// Mask the values of the records and of the deferred updates restoring their foreign keys
+func (p *Parser) maskRecords(records []Record, updates []DeferredUpdate) ([]Record, []DeferredUpdate) {
+	masks := p.columnMasks()
+	if len(masks) == 0 {
+		return records, updates
+	}
+
+	maskedRecords := make([]Record, len(records))
+	for i, record := range records {
+		record.Values = p.maskValues(masks, record.Table, record.Columns, record.Values)
+		maskedRecords[i] = record
+	}
+	maskedUpdates := make([]DeferredUpdate, len(updates))
+	for i, update := range updates {
+		update.Values = p.maskValues(masks, update.Table, update.Columns, update.Values)
+		update.Key.Values = p.maskValues(masks, update.Table, update.Key.Columns, update.Key.Values)
+		maskedUpdates[i] = update
+	}
+	return maskedRecords, maskedUpdates
+}
@@ -0,0 +1,137 @@
+package parser_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestMaskingRules(t *testing.T) {
+	t.Run("should mask values deterministically", func(t *testing.T) {
+		for _, strategy := range []parser.MaskStrategy{parser.MaskHash, parser.MaskEmail, parser.MaskName, parser.MaskPhone} {
+			t.Run(string(strategy), func(t *testing.T) {
+				rule := parser.MaskingRule{Column: "users.email", Strategy: strategy}
+				masked := rule.Mask("john@doe.com", "salt")
+				assert.NotEqual(t, "john@doe.com", masked)
+				assert.Equal(t, masked, rule.Mask("john@doe.com", "salt"))
+				assert.NotEqual(t, masked, rule.Mask("jane@doe.com", "salt"))
+				assert.NotEqual(t, masked, rule.Mask("john@doe.com", "pepper"))
+			})
+		}
+	})
+
+	t.Run("should mask values by strategy", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			rule     parser.MaskingRule
+			value    interface{}
+			expected interface{}
+			pattern  string
+		}{
+			{name: "Fixed", rule: parser.MaskingRule{Strategy: parser.MaskFixed, Value: "redacted"}, value: "secret", expected: "redacted"},
+			{name: "Null", rule: parser.MaskingRule{Strategy: parser.MaskNull}, value: "secret", expected: nil},
+			{name: "Null input", rule: parser.MaskingRule{Strategy: parser.MaskEmail}, value: nil, expected: nil},
+			{name: "Partial", rule: parser.MaskingRule{Strategy: parser.MaskPartial}, value: "4111111111111111", expected: "************1111"},
+			{name: "Partial with keep", rule: parser.MaskingRule{Strategy: parser.MaskPartial, Keep: 2}, value: "secret", expected: "****et"},
+			{name: "Partial of short value", rule: parser.MaskingRule{Strategy: parser.MaskPartial}, value: "abc", expected: "abc"},
+			{name: "Hash of a short string", rule: parser.MaskingRule{Strategy: parser.MaskHash}, value: "ab", pattern: `^[0-9a-f]{64}$`},
+			{name: "Email", rule: parser.MaskingRule{Strategy: parser.MaskEmail}, value: "john@doe.com", pattern: `^user_[0-9a-f]{16}@example\.com$`},
+			{name: "Name", rule: parser.MaskingRule{Strategy: parser.MaskName}, value: "John Doe", pattern: `^[A-Z][a-z]+ [A-Z][a-z]+$`},
+			{name: "Phone", rule: parser.MaskingRule{Strategy: parser.MaskPhone}, value: "+1 202 555 0143", pattern: `^555-\d{3}-\d{4}$`},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				masked := tc.rule.Mask(tc.value, "salt")
+				if tc.pattern != "" {
+					assert.Regexp(t, tc.pattern, masked)
+				} else {
+					assert.Equal(t, tc.expected, masked)
+				}
+			})
+		}
+	})
+
+	t.Run("should hash integers into integers of the same type", func(t *testing.T) {
+		rule := parser.MaskingRule{Strategy: parser.MaskHash}
+		assert.IsType(t, int16(0), rule.Mask(int16(7), "salt"))
+		assert.IsType(t, int32(0), rule.Mask(int32(7), "salt"))
+		assert.IsType(t, int64(0), rule.Mask(int64(7), "salt"))
+		assert.Positive(t, rule.Mask(int32(7), "salt"))
+		assert.Negative(t, rule.Mask(int64(-7), "salt"))
+		assert.Equal(t, 0, rule.Mask(0, "salt"))
+		assert.Equal(t, rule.Mask(int32(7), "salt"), int32(rule.Mask(7, "salt").(int)))
+	})
+
+	t.Run("should hash an integer to the same value whatever its type", func(t *testing.T) {
+		rule := parser.MaskingRule{Strategy: parser.MaskHash}
+
+		// A bigint foreign key matches the integer or smallint key it references
+		for _, v := range []int64{1, 7, -7, math.MaxInt16, math.MaxInt16 + 1, math.MinInt16 - 1, math.MaxInt32, math.MinInt32} {
+			masked := rule.Mask(v, "salt").(int64)
+			assert.Equal(t, masked, int64(rule.Mask(int32(v), "salt").(int32)), "int32 %d masked differently", v)
+			assert.Equal(t, masked, int64(rule.Mask(int(v), "salt").(int)), "int %d masked differently", v)
+			if v >= math.MinInt16 && v <= math.MaxInt16 {
+				assert.Equal(t, masked, int64(rule.Mask(int16(v), "salt").(int16)), "int16 %d masked differently", v)
+			}
+		}
+
+		// Values beyond a smaller type are never masked to a value of it, which would collide with its own values
+		for v := int64(math.MaxInt16 + 1); v < math.MaxInt16+1000; v++ {
+			masked := rule.Mask(v, "salt").(int64)
+			assert.True(t, masked > math.MaxInt16 && masked <= math.MaxInt32, "%d masked to %d", v, masked)
+		}
+		masked := rule.Mask(int64(math.MaxInt32)+1, "salt").(int64)
+		assert.Greater(t, masked, int64(math.MaxInt32))
+	})
+
+	t.Run("should hash integers without collisions", func(t *testing.T) {
+		rule := parser.MaskingRule{Strategy: parser.MaskHash}
+
+		// Every smallint maps to a distinct smallint of the same sign
+		seen := make(map[int16]bool)
+		for v := math.MinInt16; v <= math.MaxInt16; v++ {
+			masked := rule.Mask(int16(v), "salt").(int16)
+			assert.False(t, seen[masked], "%d masked to the already used %d", v, masked)
+			assert.Equal(t, v > 0, masked > 0, "%d masked to %d", v, masked)
+			seen[masked] = true
+		}
+
+		for _, v := range []int64{1, 2, math.MaxInt64, -1, math.MinInt64} {
+			masked := rule.Mask(v, "salt").(int64)
+			assert.Equal(t, v > 0, masked > 0, "%d masked to %d", v, masked)
+		}
+	})
+
+	t.Run("should validate rules", func(t *testing.T) {
+		assert.NoError(t, parser.MaskingRule{Column: "public.users.email", Strategy: parser.MaskEmail}.Validate())
+		assert.Error(t, parser.MaskingRule{Column: "email", Strategy: parser.MaskEmail}.Validate())
+		assert.Error(t, parser.MaskingRule{Column: "users.email", Strategy: "scramble"}.Validate())
+		assert.Error(t, parser.MaskingRule{Column: "users.ssn", Strategy: parser.MaskPartial, Keep: -1}.Validate())
+	})
+
+	t.Run("should load rules from a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "masking.yaml")
+		err := os.WriteFile(path, []byte(`
+- column: users.email
+  strategy: email
+- column: cards.number
+  strategy: partial
+  keep: 4
+`), 0o644)
+		assert.NoError(t, err)
+
+		rules, err := parser.LoadMaskingRules(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []parser.MaskingRule{
+				{Column: "users.email", Strategy: parser.MaskEmail},
+				{Column: "cards.number", Strategy: parser.MaskPartial, Keep: 4},
+			}, rules)
+		}
+	})
+}
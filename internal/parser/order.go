@@ -0,0 +1,420 @@
+package parser
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// Deferred assignment of foreign key columns which had to be inserted as NULL
+// to break a dependency cycle, applied once every record is inserted
+type DeferredUpdate struct {
+	Table   Table
+	Key     PrimaryKey
+	Columns []Column
+	Values  []interface{}
+}
+
+// Foreign key link between two records of a graph
+type dependency struct {
+	child        int
+	parent       int
+	relationship Relationship
+	broken       bool
+}
+
+// OrderRecords sorts records so that every record comes after the records it
+// references according to the relationships of the parser. Records keep their
+// original relative order wherever the dependencies allow it.
+//
+// Cycles are broken by inserting NULL into a nullable foreign key of one of the
+// records in the cycle, the returned updates restore those links afterwards.
+func (p *Parser) OrderRecords(records []Record) ([]Record, []DeferredUpdate) {
+	// Work on a copy as values of records in cycles are modified
+	records = append([]Record(nil), records...)
+
+	deps := p.recordDependencies(records)
+	outgoing := make([][]int, len(records))
+	incoming := make([][]int, len(records))
+	pending := make([]int, len(records))
+	for i, dep := range deps {
+		outgoing[dep.child] = append(outgoing[dep.child], i)
+		incoming[dep.parent] = append(incoming[dep.parent], i)
+		pending[dep.child]++
+	}
+
+	ready := &indexHeap{}
+	for i := range records {
+		if pending[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	emitted := make([]bool, len(records))
+	ordered := make([]Record, 0, len(records))
+	var updates []DeferredUpdate
+
+	for len(ordered) < len(records) {
+		if ready.Len() == 0 {
+			// Every remaining record waits for another one, so there is a cycle
+			i, d := findBreakableDependency(records, deps, outgoing, emitted)
+			if d >= 0 {
+				updates = append(updates, breakDependency(records, &deps[d]))
+				pending[i]--
+			} else {
+				// Cycle consists of NOT NULL columns only, insert the record as is
+				// and rely on deferrable constraints to accept it
+				p.logger.Printf("unable to break dependency cycle at table %s, no nullable foreign key found", records[i].Table.FullName())
+				for _, d := range outgoing[i] {
+					if !deps[d].broken && !emitted[deps[d].parent] {
+						deps[d].broken = true
+						pending[i]--
+					}
+				}
+			}
+			if pending[i] == 0 {
+				heap.Push(ready, i)
+			}
+			continue
+		}
+
+		i := heap.Pop(ready).(int)
+		emitted[i] = true
+		ordered = append(ordered, records[i])
+
+		for _, d := range incoming[i] {
+			if deps[d].broken {
+				continue
+			}
+			child := deps[d].child
+			pending[child]--
+			if pending[child] == 0 {
+				heap.Push(ready, child)
+			}
+		}
+	}
+
+	return ordered, updates
+}
+
+// Sort records so that every record comes after the records it references, like OrderRecords
+// but without breaking cycles, the earliest record of a cycle simply comes first
+func (p *Parser) dependencyOrder(records []Record) []Record {
+	pending := make([]int, len(records))
+	dependents := make([][]int, len(records))
+	for _, dep := range p.recordDependencies(records) {
+		if dep.child == dep.parent {
+			continue
+		}
+		pending[dep.child]++
+		dependents[dep.parent] = append(dependents[dep.parent], dep.child)
+	}
+
+	ready := &indexHeap{}
+	for i := range records {
+		if pending[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	emitted := make([]bool, len(records))
+	ordered := make([]Record, 0, len(records))
+	earliest := 0
+	for len(ordered) < len(records) {
+		var i int
+		if ready.Len() > 0 {
+			i = heap.Pop(ready).(int)
+		} else {
+			for emitted[earliest] {
+				earliest++
+			}
+			i = earliest
+		}
+		if emitted[i] {
+			continue
+		}
+		emitted[i] = true
+		ordered = append(ordered, records[i])
+
+		for _, child := range dependents[i] {
+			pending[child]--
+			if pending[child] == 0 {
+				heap.Push(ready, child)
+			}
+		}
+	}
+	return ordered
+}
+
+// Put values postponed by OrderRecords back into the ordered records, for outputs
+// which describe records rather than load them and so have no cycles to break
+func restoreDeferredUpdates(records []Record, updates []DeferredUpdate) []Record {
+	if len(updates) == 0 {
+		return records
+	}
+	records = append([]Record(nil), records...)
+
+	byKey := make(map[string]int, len(records))
+	for i, record := range records {
+		byKey[record.Table.FullName()+encodeKey(record.primaryKey().Values)] = i
+	}
+	for _, update := range updates {
+		i, ok := byKey[update.Table.FullName()+encodeKey(update.Key.Values)]
+		if !ok {
+			continue
+		}
+		values := append([]interface{}(nil), records[i].Values...)
+		for j, updateCol := range update.Columns {
+			for k, col := range records[i].Columns {
+				if col.Name == updateCol.Name {
+					values[k] = update.Values[j]
+					break
+				}
+			}
+		}
+		records[i].Values = values
+	}
+	return records
+}
+
+// Group ordered records into one group per table. Tables are ordered by their
+// relationships, so that grouping doesn't put a record before the records it
+// references. When tables reference each other in a cycle, only consecutive
+// records of the same table are grouped.
+func (p *Parser) groupRecordsByTable(records []Record) [][]Record {
+	var tables []string
+	groups := make(map[string][]Record)
+	for _, record := range records {
+		name := record.Table.FullName()
+		if _, ok := groups[name]; !ok {
+			tables = append(tables, name)
+		}
+		groups[name] = append(groups[name], record)
+	}
+
+	// Count references between tables of the graph, self references are
+	// satisfied by the order of records within a group
+	position := make(map[string]int, len(tables))
+	for i, name := range tables {
+		position[name] = i
+	}
+	pending := make([]int, len(tables))
+	dependents := make([][]int, len(tables))
+	seen := make(map[[2]int]bool)
+	for _, rel := range p.Relationships {
+		child, ok := position[rel.SourceTable.FullName()]
+		if !ok {
+			continue
+		}
+		parent, ok := position[rel.TargetTable.FullName()]
+		if !ok || child == parent || seen[[2]int{child, parent}] {
+			continue
+		}
+		seen[[2]int{child, parent}] = true
+		pending[child]++
+		dependents[parent] = append(dependents[parent], child)
+	}
+
+	ready := &indexHeap{}
+	for i := range tables {
+		if pending[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+	var ordered [][]Record
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		ordered = append(ordered, groups[tables[i]])
+		for _, child := range dependents[i] {
+			pending[child]--
+			if pending[child] == 0 {
+				heap.Push(ready, child)
+			}
+		}
+	}
+
+	if len(ordered) < len(tables) {
+		return groupRecords(records, len(records))
+	}
+	return ordered
+}
+
+// Find links between records where a record references another record of the same graph
+func (p *Parser) recordDependencies(records []Record) []dependency {
+	// Group relationships by the child table
+	relsBySource := make(map[string][]Relationship)
+	for _, rel := range p.Relationships {
+		relsBySource[rel.SourceTable.FullName()] = append(relsBySource[rel.SourceTable.FullName()], rel)
+	}
+
+	// Index records by the values of referenced columns, built on demand
+	// as relationships don't necessarily reference primary keys
+	indexes := make(map[string]map[string]int)
+	index := func(rel Relationship) map[string]int {
+		indexKey := fmt.Sprintf("%s%+v", rel.TargetTable.FullName(), rel.TargetColumn)
+		if idx, ok := indexes[indexKey]; ok {
+			return idx
+		}
+		idx := make(map[string]int)
+		for i, record := range records {
+			if record.Table.FullName() != rel.TargetTable.FullName() {
+				continue
+			}
+			if values, ok := record.valuesOf(rel.TargetColumn); ok {
+				idx[encodeKey(values)] = i
+			}
+		}
+		indexes[indexKey] = idx
+		return idx
+	}
+
+	var deps []dependency
+	for i, record := range records {
+		for _, rel := range relsBySource[record.Table.FullName()] {
+			if !rel.appliesTo(record) {
+				continue
+			}
+			values, ok := record.valuesOf(rel.SourceColumn)
+			if !ok {
+				continue
+			}
+			if parent, ok := index(rel)[encodeKey(values)]; ok {
+				deps = append(deps, dependency{child: i, parent: parent, relationship: rel})
+			}
+		}
+	}
+	return deps
+}
+
+// Find a dependency inside a cycle which can be postponed, it is the first one
+// with nullable foreign key columns of the earliest record in a cycle. When there
+// is none, the earliest record in a cycle is returned with a negative dependency index.
+func findBreakableDependency(records []Record, deps []dependency, outgoing [][]int, emitted []bool) (int, int) {
+	components := strongComponents(deps, outgoing, emitted)
+
+	first := -1
+	for i := range records {
+		if emitted[i] {
+			continue
+		}
+		for _, d := range outgoing[i] {
+			dep := deps[d]
+			if dep.broken || emitted[dep.parent] || components[dep.parent] != components[i] {
+				continue
+			}
+			if first < 0 {
+				first = i
+			}
+			if isNullable(dep.relationship.SourceColumn) && len(records[i].primaryKey().Columns) > 0 {
+				return i, d
+			}
+		}
+	}
+	return first, -1
+}
+
+// Null foreign key columns of the child record and return the update restoring them
+func breakDependency(records []Record, dep *dependency) DeferredUpdate {
+	dep.broken = true
+	child := &records[dep.child]
+
+	update := DeferredUpdate{
+		Table:   child.Table,
+		Key:     child.primaryKey(),
+		Columns: dep.relationship.SourceColumn,
+		Values:  make([]interface{}, len(dep.relationship.SourceColumn)),
+	}
+
+	values := append([]interface{}(nil), child.Values...)
+	for i, relCol := range dep.relationship.SourceColumn {
+		for j, col := range child.Columns {
+			if col.Name == relCol.Name {
+				update.Values[i] = values[j]
+				values[j] = nil
+				break
+			}
+		}
+	}
+	child.Values = values
+
+	return update
+}
+
+// Label records not yet emitted with the strongly connected component they belong to
+func strongComponents(deps []dependency, outgoing [][]int, emitted []bool) []int {
+	n := len(outgoing)
+	components := make([]int, n)
+	indexes := make([]int, n)
+	lowlinks := make([]int, n)
+	onStack := make([]bool, n)
+	for i := range indexes {
+		indexes[i] = -1
+		components[i] = -1
+	}
+	var stack []int
+	index, component := 0, 0
+
+	var connect func(v int)
+	connect = func(v int) {
+		indexes[v] = index
+		lowlinks[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, d := range outgoing[v] {
+			if deps[d].broken || emitted[deps[d].parent] {
+				continue
+			}
+			w := deps[d].parent
+			if indexes[w] < 0 {
+				connect(w)
+				lowlinks[v] = min(lowlinks[v], lowlinks[w])
+			} else if onStack[w] {
+				lowlinks[v] = min(lowlinks[v], indexes[w])
+			}
+		}
+
+		if lowlinks[v] == indexes[v] {
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				components[w] = component
+				if w == v {
+					break
+				}
+			}
+			component++
+		}
+	}
+
+	for v := 0; v < n; v++ {
+		if !emitted[v] && indexes[v] < 0 {
+			connect(v)
+		}
+	}
+	return components
+}
+
+func isNullable(columns []Column) bool {
+	for _, col := range columns {
+		if !col.IsNullable {
+			return false
+		}
+	}
+	return len(columns) > 0
+}
+
+// Min-heap of record indexes, used to keep the original order among ready records
+type indexHeap []int
+
+func (h indexHeap) Len() int           { return len(h) }
+func (h indexHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *indexHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,97 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestOrderRecords(t *testing.T) {
+	users := parser.Table{Name: "users", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "department_id", DataType: "integer", IsNullable: true},
+	}}
+	departments := parser.Table{Name: "departments", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "manager_id", DataType: "integer", IsNullable: true},
+	}}
+	orders := parser.Table{Name: "orders", Schema: "public", Columns: []parser.Column{
+		{Name: "id", DataType: "integer", IsPrimary: true},
+		{Name: "user_id", DataType: "integer"},
+	}}
+
+	p := &parser.Parser{Relationships: []parser.Relationship{
+		{SourceTable: orders, SourceColumn: orders.Columns[1:], TargetTable: users, TargetColumn: users.Columns[:1], RelationType: parser.ManyToOne},
+		{SourceTable: users, SourceColumn: users.Columns[1:], TargetTable: departments, TargetColumn: departments.Columns[:1], RelationType: parser.ManyToOne},
+		{SourceTable: departments, SourceColumn: departments.Columns[1:], TargetTable: users, TargetColumn: users.Columns[:1], RelationType: parser.ManyToOne},
+	}}
+
+	user := func(id, departmentID interface{}) parser.Record {
+		return parser.Record{Table: users, Columns: users.Columns, Values: []interface{}{id, departmentID}}
+	}
+	department := func(id, managerID interface{}) parser.Record {
+		return parser.Record{Table: departments, Columns: departments.Columns, Values: []interface{}{id, managerID}}
+	}
+	order := func(id, userID interface{}) parser.Record {
+		return parser.Record{Table: orders, Columns: orders.Columns, Values: []interface{}{id, userID}}
+	}
+
+	testCases := []struct {
+		name          string
+		records       []parser.Record
+		expectRecords []parser.Record
+		expectUpdates []parser.DeferredUpdate
+	}{
+		{
+			name:          "Already ordered",
+			records:       []parser.Record{user(int32(1), nil), order(int32(1), int32(1)), order(int32(2), int32(1))},
+			expectRecords: []parser.Record{user(int32(1), nil), order(int32(1), int32(1)), order(int32(2), int32(1))},
+		},
+		{
+			name:          "Child before parent",
+			records:       []parser.Record{order(int32(1), int32(2)), user(int32(1), nil), user(int32(2), nil)},
+			expectRecords: []parser.Record{user(int32(1), nil), user(int32(2), nil), order(int32(1), int32(2))},
+		},
+		{
+			name:          "Reference to a record outside of the graph",
+			records:       []parser.Record{order(int32(1), int32(5)), user(int32(1), nil)},
+			expectRecords: []parser.Record{order(int32(1), int32(5)), user(int32(1), nil)},
+		},
+		{
+			name:          "Different integer types",
+			records:       []parser.Record{order(int32(1), int64(1)), user(1, nil)},
+			expectRecords: []parser.Record{user(1, nil), order(int32(1), int64(1))},
+		},
+		{
+			name:          "Cycle",
+			records:       []parser.Record{department(int32(1), int32(1)), user(int32(1), int32(1)), order(int32(1), int32(1))},
+			expectRecords: []parser.Record{department(int32(1), nil), user(int32(1), int32(1)), order(int32(1), int32(1))},
+			expectUpdates: []parser.DeferredUpdate{
+				{
+					Table:   departments,
+					Key:     parser.PrimaryKey{Columns: departments.Columns[:1], Values: []interface{}{int32(1)}},
+					Columns: departments.Columns[1:],
+					Values:  []interface{}{int32(1)},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			records, updates := p.OrderRecords(tc.records)
+
+			assert.Equal(t, tc.expectRecords, records)
+			assert.Equal(t, tc.expectUpdates, updates)
+		})
+	}
+
+	t.Run("should not modify given records", func(t *testing.T) {
+		records := []parser.Record{department(int32(1), int32(1)), user(int32(1), int32(1))}
+		p.OrderRecords(records)
+
+		assert.Equal(t, []interface{}{int32(1), int32(1)}, records[0].Values)
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"sync"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -19,8 +21,25 @@ type Parser struct {
 	TablesWithoutPrimaryKey []Table
 	Relationships           []Relationship
 	TableToPKColumnsMap     map[string][]Column
-	RelationshipVisits      []RelationshipVisit
-	RecordVisits            []RecordVisit
+	// Column names of every primary key and unique index by table
+	TableToUniqueKeysMap map[string][][]string
+	// Maximum length of the character columns with a length limit by table and column name
+	TableToColumnLengthsMap map[string]map[string]int
+	// Parent references of the last built graph which weren't extracted because of the depth limits
+	UnresolvedParents []UnresolvedParent
+	// Children of the last built graph which were left out by row filters or limits
+	Truncations []Truncation
+
+	// Keys of the records fetched by the traversal with the depths they were reached at
+	visitedRecords *depthSet
+	// Pairs of tables a relationship was followed between, in the direction it was followed
+	visitedRelationships *visitSet[relationshipVisit]
+	// Parent references not followed because of the depth limits
+	boundary []UnresolvedParent
+	// Children left out by row filters or limits
+	truncations []Truncation
+	// Transactions the running traversal reads from when it reads a consistent snapshot
+	reader *snapshotReader
 }
 
 // Initialize a new parser
@@ -34,200 +53,540 @@ func NewParser(pool *pgxpool.Pool, config *parserConfig) (*Parser, error) {
 		TablesWithoutPrimaryKey: make([]Table, 0),
 		Relationships:           make([]Relationship, 0),
 		TableToPKColumnsMap:     make(map[string][]Column),
-		RelationshipVisits:      make([]RelationshipVisit, 0),
-		RecordVisits:            make([]RecordVisit, 0),
+		TableToUniqueKeysMap:    make(map[string][][]string),
+		TableToColumnLengthsMap: make(map[string]map[string]int),
+
+		visitedRecords:       newDepthSet(),
+		visitedRelationships: newVisitSet[relationshipVisit](),
 	}
 	ctx := context.Background()
 
-	tablesWithPK, tablesWithoutPK, err := p.discoverTables(ctx)
+	if err := config.compileRelationshipRules(); err != nil {
+		return nil, fmt.Errorf("invalid relationship rules: %w", err)
+	}
+
+	// Use the cached schema if it was taken from the same catalog state
+	var fingerprint string
+	cached := false
+	if config.SchemaCache != "" {
+		var err error
+		fingerprint, err = p.schemaFingerprint(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute schema fingerprint: %w", err)
+		}
+		snapshot, err := LoadSchemaSnapshot(config.SchemaCache)
+		// Caches written before unique keys and column lengths were recorded are discovered again
+		if err == nil && snapshot.Fingerprint == fingerprint && snapshot.TableToUniqueKeysMap != nil && snapshot.TableToColumnLengthsMap != nil {
+			p.applySnapshot(snapshot)
+			cached = true
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			p.logger.Printf("ignoring schema cache %s: %v", config.SchemaCache, err)
+		}
+	}
+
+	if !cached {
+		if err := p.discoverSchema(ctx); err != nil {
+			return nil, err
+		}
+
+		if config.SchemaCache != "" {
+			snapshot := p.snapshot(fingerprint)
+			if err := snapshot.Save(config.SchemaCache); err != nil {
+				return nil, fmt.Errorf("failed to save schema cache: %w", err)
+			}
+		}
+	}
+
+	// Virtual relationships come from the config rather than the catalog, so they are never cached
+	if err := p.addVirtualRelationships(); err != nil {
+		return nil, fmt.Errorf("failed to add virtual relationships: %w", err)
+	}
+	if len(p.Relationships) == 0 {
+		return nil, ErrNoRelationshipsFound
+	}
+	if err := p.checkMaskingRules(); err != nil {
+		return nil, fmt.Errorf("invalid masking rules: %w", err)
+	}
+
+	return p, nil
+}
+
+// Discover tables, relationships and primary keys of the configured schemas
+func (p *Parser) discoverSchema(ctx context.Context) error {
+	cat, err := p.loadCatalog(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract tables: %w", err)
+		return fmt.Errorf("failed to load catalog: %w", err)
 	}
+
+	tablesWithPK, tablesWithoutPK := p.discoverTables(cat)
 	if len(tablesWithPK) == 0 {
-		return nil, ErrNoTablesFound
+		return ErrNoTablesFound
 	}
 	p.TablesWithPrimaryKey = tablesWithPK
 	p.TablesWithoutPrimaryKey = tablesWithoutPK
 
-	relationships, err := p.discoverRelationships(ctx)
+	relationships, err := p.discoverRelationships(cat)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract relationships: %w", err)
-	}
-	if len(relationships) == 0 {
-		return nil, ErrNoRelationshipsFound
+		return fmt.Errorf("failed to extract relationships: %w", err)
 	}
 	p.Relationships = relationships
 
+	for _, t := range cat.tables {
+		for _, attnums := range t.uniqueKeys {
+			columns, err := t.columnsOf(attnums)
+			if err != nil {
+				return fmt.Errorf("failed to extract unique keys: %w", err)
+			}
+			names := make([]string, len(columns))
+			for i, col := range columns {
+				names[i] = col.Name
+			}
+			p.TableToUniqueKeysMap[t.table.FullName()] = append(p.TableToUniqueKeysMap[t.table.FullName()], names)
+		}
+		if t.maxLengths != nil {
+			p.TableToColumnLengthsMap[t.table.FullName()] = t.maxLengths
+		}
+	}
+
 	for _, table := range p.TablesWithPrimaryKey {
 		pk, err := p.discoverTablePKColumn(table)
 		if err != nil {
-			return nil, fmt.Errorf("failed to extract primary keys for table %s: %w", table.FullName(), err)
+			return fmt.Errorf("failed to extract primary keys for table %s: %w", table.FullName(), err)
 		}
 		p.TableToPKColumnsMap[table.FullName()] = pk
 	}
 
-	return p, nil
+	return nil
 }
 
-func (p *Parser) BuildGraph(ctx context.Context, table Table, pk PrimaryKey) ([]Record, error) {
-	var records []Record
+// BuildGraph collects the entry records of the table with the given primary keys and their related records,
+// the graph of several entry records is the union of their graphs
+func (p *Parser) BuildGraph(ctx context.Context, table Table, pks ...PrimaryKey) ([]Record, error) {
+	set := newRecordSet(nil)
+	if err := p.buildGraph(ctx, table, pks, set); err != nil {
+		return nil, err
+	}
+	return set.records, nil
+}
 
-	record, err := p.FetchRecord(ctx, table, pk)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch entry record: %w", err)
+// Traverse the graph of the entry records into the given set
+func (p *Parser) buildGraph(ctx context.Context, table Table, pks []PrimaryKey, set *recordSet) error {
+	if len(pks) == 0 {
+		return ErrNoEntryRecords
 	}
 
-	if p.config.FollowParents {
-		if err := p.TraverseParents(ctx, record, &records); err != nil {
-			return nil, fmt.Errorf("failed to traverse parents: %w", err)
+	// Every query of the traversal sees the database as it was when the traversal started,
+	// unless the snapshot was started before the entry records were selected
+	if p.config.ConsistentSnapshot && p.reader == nil {
+		if err := p.BeginSnapshot(ctx); err != nil {
+			return err
 		}
+		defer p.EndSnapshot(context.Background())
 	}
 
-	records = append(records, record)
-
-	if p.config.FollowChildren {
-		if err := p.TraverseChildren(ctx, record, &records); err != nil {
-			return nil, fmt.Errorf("failed to traverse children: %w", err)
+	// Entry records start the traversal together, none of them is subject to the depth limits
+	var entries []node
+	for _, pk := range pks {
+		record, err := p.fetchRecord(ctx, table, pk)
+		if err != nil {
+			return fmt.Errorf("failed to fetch entry record: %w", err)
 		}
+		if !p.visitRecord(hashRecord(record), depth{}) {
+			continue
+		}
+		entries = append(entries, node{record: record})
+	}
+
+	if err := p.addWithParents(ctx, entries, set); err != nil {
+		return fmt.Errorf("failed to traverse parents: %w", err)
+	}
+	if err := p.traverse(ctx, entries, set); err != nil {
+		return fmt.Errorf("failed to traverse children: %w", err)
+	}
+
+	// Let the user know the graph is not self-contained
+	p.UnresolvedParents = p.resolveBoundary(set)
+	for _, ref := range p.UnresolvedParents {
+		p.logger.Printf("record of table %s with pk %v references a record of table %s beyond the depth limit",
+			ref.Record.Table.FullName(), ref.Record.primaryKey().Values, ref.Relationship.TargetTable.FullName())
+	}
+	p.Truncations = p.truncations
+	for _, t := range p.Truncations {
+		p.logger.Printf("children of table %s referencing %s %v truncated by %s",
+			t.Relationship.SourceTable.FullName(), t.Relationship.TargetTable.FullName(), t.ParentKey, t.Reason)
 	}
 
-	return records, nil
+	return nil
 }
 
-func (p *Parser) ExtractGraph(ctx context.Context, table Table, pk PrimaryKey) (string, error) {
+func (p *Parser) ExtractGraph(ctx context.Context, table Table, pks ...PrimaryKey) (string, error) {
 	defer p.Reset()
 
-	records, err := p.BuildGraph(ctx, table, pk)
+	// Fail before traversing rather than after
+	if p.config.KeyRemap == KeyRemapSequence && p.config.SequencePool == nil {
+		return "", ErrNoSequencePool
+	}
+	// COPY blocks hold every record of a table and can't handle existing rows
+	if p.config.Format == FormatCopy && (p.config.ConflictMode != ConflictNone || p.config.BatchSize > 1) {
+		return "", fmt.Errorf("copy output can't be combined with a conflict mode or a batch size")
+	}
+
+	records, err := p.BuildGraph(ctx, table, pks...)
 	if err != nil {
 		return "", fmt.Errorf("failed to build graph: %w", err)
 	}
 
-	sql, err := p.GenerateInsertStatements(ctx, records)
+	records, err = p.remapKeys(ctx, p.config.SequencePool, records)
+	if err != nil {
+		return "", fmt.Errorf("failed to remap keys: %w", err)
+	}
+
+	// Make sure referenced records are inserted first
+	records, updates := p.OrderRecords(records)
+	records, updates = p.maskRecords(records, updates)
+
+	var sql string
+	switch p.config.Format {
+	case FormatJSON, FormatNDJSON, FormatDOT, FormatMermaid:
+		// Records are described rather than inserted, so they keep every reference
+		records = restoreDeferredUpdates(records, updates)
+		edges := p.followedEdges(records)
+		generators := map[OutputFormat]func(context.Context, []Record, []Edge) (string, error){
+			FormatJSON:    p.GenerateJSON,
+			FormatNDJSON:  p.GenerateNDJSON,
+			FormatDOT:     p.GenerateDOT,
+			FormatMermaid: p.GenerateMermaid,
+		}
+		out, err := generators[p.config.Format](ctx, records, edges)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate %s output: %w", p.config.Format, err)
+		}
+		return out, nil
+	case FormatCopy:
+		sql, err = p.GenerateCopyStatements(ctx, records)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate copy statements: %w", err)
+		}
+	default:
+		sql, err = p.GenerateInsertStatements(ctx, records)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate insert statements: %w", err)
+		}
+	}
+
+	updateSQL, err := p.GenerateUpdateStatements(ctx, updates)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate insert statements: %w", err)
+		return "", fmt.Errorf("failed to generate update statements: %w", err)
 	}
 
-	return sql, nil
+	// Let the reader of the output know it doesn't hold every child
+	return truncationComments(p.Truncations) + sql + updateSQL, nil
 }
 
 func (p *Parser) Reset() {
-	p.RelationshipVisits = make([]RelationshipVisit, 0)
-	p.RecordVisits = make([]RecordVisit, 0)
+	p.visitedRecords = newDepthSet()
+	p.visitedRelationships = newVisitSet[relationshipVisit]()
+	p.boundary = nil
+	p.truncations = nil
 }
 
 // TraverseParents gets all relationships where table of the given record is the source (child)
 func (p *Parser) TraverseParents(ctx context.Context, record Record, records *[]Record) error {
+	set := newRecordSet(*records)
+	p.visitRecord(hashRecord(record), depth{})
+	levels, err := p.collectParents(ctx, []node{{record: record}})
+	if err == nil {
+		err = p.addLevels(ctx, levels, set)
+	}
+	*records = set.records
+	return err
+}
+
+// TraverseChildren gets all relationships where table of the given record is the target (parent)
+func (p *Parser) TraverseChildren(ctx context.Context, record Record, records *[]Record) error {
+	set := newRecordSet(*records)
+	p.visitRecord(hashRecord(record), depth{})
+	err := p.traverse(ctx, []node{{record: record}}, set)
+	*records = set.records
+	return err
+}
+
+// Record reached by the traversal and its distance from the entry records
+type node struct {
+	record Record
+	depth  depth
+}
+
+// Traverse the graph breadth-first from records which are already part of the set. Every level
+// holds the children of the previous one, which are added to the set after their parents.
+func (p *Parser) traverse(ctx context.Context, frontier []node, set *recordSet) error {
+	for len(frontier) > 0 {
+		children, err := p.childLevel(ctx, frontier, set)
+		if err != nil {
+			return err
+		}
+		if err := p.addWithParents(ctx, children, set); err != nil {
+			return fmt.Errorf("failed to traverse parents of children: %w", err)
+		}
+		frontier = children
+	}
+	return nil
+}
+
+// Add the records to the set after their parents, so that parents come first except in cycles
+func (p *Parser) addWithParents(ctx context.Context, nodes []node, set *recordSet) error {
+	levels, err := p.collectParents(ctx, nodes)
+	if err != nil {
+		return err
+	}
+	return p.addLevels(ctx, append([][]node{nodes}, levels...), set)
+}
+
+// Add levels of records to the set starting from the last one, which holds the farthest parents.
+// Records referencing other records of the same level are put after them.
+func (p *Parser) addLevels(ctx context.Context, levels [][]node, set *recordSet) error {
+	var records []Record
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, n := range levels[i] {
+			records = append(records, n.record)
+		}
+	}
+	for _, record := range p.dependencyOrder(records) {
+		if err := set.add(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetch the parents of the records which weren't visited yet, then their parents and so on.
+// Returns a level of parents per hop.
+func (p *Parser) collectParents(ctx context.Context, nodes []node) ([][]node, error) {
+	var levels [][]node
+	for level := nodes; len(level) > 0; {
+		parents, err := p.parentLevel(ctx, level)
+		if err != nil {
+			return nil, err
+		}
+		if len(parents) > 0 {
+			levels = append(levels, parents)
+		}
+		level = parents
+	}
+	return levels, nil
+}
+
+// Fetch the parents of the level which weren't visited yet with a query per relationship.
+// Keys are collected and marked as visited in the order of the level, so that the queries
+// can run concurrently without changing which records are returned.
+func (p *Parser) parentLevel(ctx context.Context, level []node) ([]node, error) {
 	//
 	// For example in a schema with `users` -> `orders` tables
 	// when we use `orders` as an entry record, we want to find relationships
 	// which have `orders` as a child dependency, so we look for `users` table.
 	//
-	for _, rel := range p.Relationships {
-		if rel.SourceTable.FullName() == record.Table.FullName() {
-			// Skip if we've already visited this relationship
-			// if p.hasRelationshipVisit(rel.SourceTable, rel.TargetTable) {
-			// 	continue
-			// }
+	keys := make([][][]interface{}, len(p.Relationships))
+	depths := make([]map[string][]depth, len(p.Relationships))
+	for i, rel := range p.Relationships {
+		if !p.config.followsParents(rel) {
+			continue
+		}
+
+		depths[i] = make(map[string][]depth)
+		for _, n := range level {
+			// A polymorphic relationship only references the table of the type of the record
+			if rel.SourceTable.FullName() != n.record.Table.FullName() || !rel.appliesTo(n.record) {
+				continue
+			}
 			// Mark this relationship as visited
 			p.addRelationshipVisit(rel.SourceTable, rel.TargetTable)
 
-			// Find the value of the foreign key column in our current record
-			var fkValues []interface{}
-			for _, relCol := range rel.SourceColumn {
-				for i, col := range record.Columns {
-					if col.Name == relCol.Name {
-						if record.Values[i] == nil {
-							continue
-						}
-						fkValues = append(fkValues, record.Values[i])
-						break
-					}
-				}
-			}
-			if len(fkValues) == 0 {
+			// Find the values of the foreign key columns in our current record
+			fkValues, ok := n.record.valuesOf(rel.SourceColumn)
+			if !ok {
 				continue // No foreign key value found
 			}
 
-			// Create a primary key for the parent table
-			pk, err := NewPrimaryKey(rel.TargetColumn, fkValues)
-			if err != nil {
-				return fmt.Errorf("failed to create primary key for parent table: %w", err)
+			// Stop at the depth limit, the parent may still be collected through another path
+			if !p.config.canFollowParents(n.depth) {
+				p.boundary = append(p.boundary, UnresolvedParent{Record: n.record, Relationship: rel})
+				continue
 			}
 
-			// Fetch the parent record
-			parentRecord, err := p.FetchRecord(ctx, rel.TargetTable, pk)
-			if err != nil {
-				if errors.Is(err, ErrRecordAlreadyVisited) {
-					p.logger.Printf("skipping already visited record in table %s, pk %v", rel.TargetTable.Name, pk.Values)
-					continue
-				}
-				return fmt.Errorf("failed to fetch parent record: %w", err)
+			// A parent reached before is only fetched again through a shorter path
+			if !p.visitRecord(hashKey(rel.TargetTable, rel.TargetColumn, fkValues), n.depth.parent()) {
+				p.logger.Printf("skipping already visited record in table %s, pk %v", rel.TargetTable.Name, fkValues)
+				continue
 			}
+			key := encodeKey(fkValues)
+			if _, ok := depths[i][key]; !ok {
+				keys[i] = append(keys[i], fkValues)
+			}
+			depths[i][key] = append(depths[i][key], n.depth.parent())
+		}
+	}
 
-			// Add to our records and keep traversing if this record hasn't been checked yet
-			if !p.recordExists(*records, parentRecord) {
-				// Recursively traverse parents of this parent
-				if err := p.TraverseParents(ctx, parentRecord, records); err != nil {
-					return err
+	found := make([][]Record, len(p.Relationships))
+	err := forEachConcurrently(ctx, len(p.Relationships), p.config.Concurrency, func(ctx context.Context, i int) error {
+		if len(keys[i]) == 0 {
+			return nil
+		}
+		records, err := p.findParentRecords(ctx, p.Relationships[i], keys[i])
+		if err != nil {
+			return fmt.Errorf("failed to fetch parent records: %w", err)
+		}
+		found[i] = records
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var parents []node
+	for i, rel := range p.Relationships {
+		// Keep the order of the records referencing the parents rather than the order of the query
+		byKey := make(map[string][]Record, len(found[i]))
+		for _, record := range found[i] {
+			keyValues, _ := record.valuesOf(rel.TargetColumn)
+			byKey[encodeKey(keyValues)] = append(byKey[encodeKey(keyValues)], record)
+		}
+		for _, key := range keys[i] {
+			for _, record := range byKey[encodeKey(key)] {
+				for _, d := range depths[i][encodeKey(key)] {
+					// Parents referenced by other keys than the primary key may have been collected already
+					if !isPrimaryKey(rel.TargetTable, rel.TargetColumn) && !p.visitRecord(hashRecord(record), d) {
+						continue
+					}
+					parents = append(parents, node{record: record, depth: d})
 				}
-				*records = append(*records, parentRecord)
 			}
 		}
 	}
-	return nil
+	return parents, nil
 }
 
-// TraverseChildren gets all relationships where table of the given record is the target (parent)
-func (p *Parser) TraverseChildren(ctx context.Context, record Record, records *[]Record) error {
-	// Get the primary key values of the current record
-	pkValues := make([]interface{}, 0)
-	for i, col := range record.Columns {
-		if col.IsPrimary {
-			pkValues = append(pkValues, record.Values[i])
-			continue
+// Fetch the children of the level which weren't collected yet with a query per relationship,
+// running concurrently. Children are returned in the order of the records of the level they
+// reference and of the relationships, however the queries are scheduled.
+func (p *Parser) childLevel(ctx context.Context, level []node, set *recordSet) ([]node, error) {
+	found := make([]map[string][]Record, len(p.Relationships))
+	truncations := make([][]Truncation, len(p.Relationships))
+	err := forEachConcurrently(ctx, len(p.Relationships), p.config.Concurrency, func(ctx context.Context, i int) error {
+		rel := p.Relationships[i]
+		if !p.config.followsChildren(rel) {
+			return nil
 		}
-	}
-	if len(pkValues) == 0 {
-		return nil // No primary key, can't find children
-	}
 
-	// Get all relationships where this table is the target (parent)
-	for _, rel := range p.Relationships {
-		if rel.TargetTable.FullName() == record.Table.FullName() {
-			// Skip if we've already visited this relationship
-			// if p.hasRelationshipVisit(rel.TargetTable, rel.SourceTable) {
-			// 	continue
-			// }
+		var keys [][]interface{}
+		seen := make(map[string]bool)
+		for _, n := range level {
+			if rel.TargetTable.FullName() != n.record.Table.FullName() || !p.config.canFollowChildren(n.depth) {
+				continue
+			}
+			// Get the values of the referenced columns of the current record
+			keyValues, ok := n.record.valuesOf(rel.TargetColumn)
+			if !ok {
+				continue // Key is not set, nothing can reference it
+			}
 
 			// Mark this relationship as visited
 			p.addRelationshipVisit(rel.TargetTable, rel.SourceTable)
 
-			// Find all child records that reference this record's primary key
-			childRecords, err := p.findChildRecords(ctx, rel, pkValues)
-			if err != nil {
-				return fmt.Errorf("failed to find child records: %w", err)
+			if key := encodeKey(keyValues); !seen[key] {
+				seen[key] = true
+				keys = append(keys, keyValues)
 			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
 
-			for _, childRecord := range childRecords {
-				// Add to our records if not already present
-				if !p.recordExists(*records, childRecord) {
-					if p.config.FollowParents {
-						if err := p.TraverseParents(ctx, childRecord, records); err != nil {
-							return fmt.Errorf("failed to traverse parents of child %s: %w", childRecord.Table.FullName(), err)
-						}
-					}
+		// Find all child records that reference the keys of the level
+		children, truncated, err := p.findChildRecords(ctx, rel, keys)
+		if err != nil {
+			return fmt.Errorf("failed to find child records: %w", err)
+		}
+		found[i] = children
+		truncations[i] = truncated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, truncated := range truncations {
+		p.truncations = append(p.truncations, truncated...)
+	}
 
-					*records = append(*records, childRecord)
+	var children []node
+	for _, n := range level {
+		for i, rel := range p.Relationships {
+			if found[i] == nil || rel.TargetTable.FullName() != n.record.Table.FullName() || !p.config.canFollowChildren(n.depth) {
+				continue
+			}
+			keyValues, _ := n.record.valuesOf(rel.TargetColumn)
+			for _, child := range found[i][encodeKey(keyValues)] {
+				// Add to our records if not already present, records reached before are only
+				// expanded again through a shorter path
+				hash := hashRecord(child)
+				if (set.contains(child) && !p.visitedRecords.has(hash)) || !p.visitRecord(hash, n.depth.child()) {
+					continue
+				}
+				children = append(children, node{record: child, depth: n.depth.child()})
+			}
+		}
+	}
+	return children, nil
+}
 
-					// Recursively traverse children of this child
-					if p.config.FollowChildren {
-						if err := p.TraverseChildren(ctx, childRecord, records); err != nil {
-							return err
-						}
+// Run fn for every index on up to the given number of goroutines. The first error cancels
+// the context of the running calls, skips the remaining ones and is returned.
+func forEachConcurrently(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(ctx, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		next     int
+		firstErr error
+	)
+	// Hand out the next index until every index is taken or a call failed
+	take := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil || next >= n {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := take(); ok; i, ok = take() {
+				if err := fn(ctx, i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
 					}
+					mu.Unlock()
 				}
 			}
-		}
+		}()
 	}
-	return nil
+	wg.Wait()
+	return firstErr
 }
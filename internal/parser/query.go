@@ -2,6 +2,7 @@ package parser
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -25,94 +26,251 @@ func formatPgTime(t pgtype.Time) string {
 	// Add duration to base time
 	resultTime := baseTime.Add(duration)
 
-	// Format as hh:mm:ss
-	return resultTime.Format("15:04:05")
+	// Format as hh:mm:ss, followed by the fractional seconds unless they are zero
+	return resultTime.Format("15:04:05.999999")
 }
 
-// GenerateInsertStatements generates SQL INSERT statements for the given records
+// GenerateInsertStatements generates SQL INSERT statements for the given records,
+// consecutive records of the same table are grouped into multi-row statements
+// of up to the configured batch size
 func (p *Parser) GenerateInsertStatements(ctx context.Context, records []Record) (string, error) {
 	var sb strings.Builder
 
-	for _, record := range records {
-		columnNames := make([]string, len(record.Columns))
-		for i, col := range record.Columns {
+	for _, batch := range groupRecords(records, p.config.BatchSize) {
+		columns := batch[0].Columns
+		columnNames := make([]string, len(columns))
+		for i, col := range columns {
 			columnNames[i] = col.Name
 		}
 		columnList := strings.Join(columnNames, ", ")
 
-		// Build value placeholders and collect values
-		var placeholders []string
-		var values []string
-
-		for i, val := range record.Values {
-			if val == nil {
-				values = append(values, "NULL")
-			} else {
-				switch v := val.(type) {
-				case string:
-					values = append(values, fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''")))
-				case []byte:
-					values = append(values, fmt.Sprintf("'%s'", strings.ReplaceAll(string(v), "'", "''")))
-				case int32:
-					values = append(values, fmt.Sprintf("%d", v))
-				case int16:
-					values = append(values, fmt.Sprintf("%d", v))
-				case pgtype.Time:
-					values = append(values, fmt.Sprintf("'%s'", formatPgTime(v)))
-				case pgtype.Numeric:
-					n, _ := v.Float64Value()
-					values = append(values, fmt.Sprintf("%g", n.Float64))
-				case time.Time:
-					// Format time as ISO 8601 string
-					values = append(values, fmt.Sprintf("'%s'", v.Format("2006-01-02T15:04:05.999999Z07:00")))
-				case bool:
-					if v {
-						values = append(values, "true")
-					} else {
-						values = append(values, "false")
-					}
-				case float32:
-					values = append(values, fmt.Sprintf("%g", v))
-				case float64:
-					values = append(values, fmt.Sprintf("%g", v))
-				case int:
-					values = append(values, fmt.Sprintf("%d", v))
-				case int64:
-					values = append(values, fmt.Sprintf("%d", v))
-				case map[string]interface{}:
-					// Handle JSON data (OID 3614)
-					jsonBytes, err := json.Marshal(v)
-					if err != nil {
-						p.logger.Printf("Error marshaling JSON: %v\n", err)
-						values = append(values, fmt.Sprintf("'%v'", v))
-					} else {
-						values = append(values, fmt.Sprintf("'%s'", strings.ReplaceAll(string(jsonBytes), "'", "''")))
-					}
-				case []interface{}:
-					// Handle JSON array
-					jsonBytes, err := json.Marshal(v)
-					if err != nil {
-						p.logger.Printf("Error marshaling JSON array: %v\n", err)
-						values = append(values, fmt.Sprintf("'%v'", v))
-					} else {
-						values = append(values, fmt.Sprintf("'%s'", strings.ReplaceAll(string(jsonBytes), "'", "''")))
-					}
-				default:
-					p.logger.Printf("Unknown type: %T\n", v)
-					values = append(values, fmt.Sprintf("%v", v))
-				}
+		// Collect formatted values of every record
+		rows := make([]string, len(batch))
+		for i, record := range batch {
+			values := make([]string, len(record.Values))
+			for j, val := range record.Values {
+				values[j] = p.formatValue(val)
 			}
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+			rows[i] = fmt.Sprintf("(%s)", strings.Join(values, ", "))
 		}
 
-		valueList := strings.Join(values, ", ")
+		valueList := strings.Join(rows, ", ")
 
 		// Build the INSERT statement
-		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);\n",
-			record.Table.FullName(), columnList, valueList)
+		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s;\n",
+			batch[0].Table.FullName(), columnList, valueList, p.onConflictClause(batch[0].Table, columns))
 
 		sb.WriteString(stmt)
 	}
 
 	return sb.String(), nil
 }
+
+// GenerateCopyStatements generates COPY ... FROM stdin blocks in text format for
+// the given records, one block per table whenever the dependency order allows it
+func (p *Parser) GenerateCopyStatements(ctx context.Context, records []Record) (string, error) {
+	var sb strings.Builder
+
+	for _, block := range p.groupRecordsByTable(records) {
+		columnNames := make([]string, len(block[0].Columns))
+		for i, col := range block[0].Columns {
+			columnNames[i] = col.Name
+		}
+
+		sb.WriteString(fmt.Sprintf("COPY %s (%s) FROM stdin;\n",
+			block[0].Table.FullName(), strings.Join(columnNames, ", ")))
+
+		for _, record := range block {
+			for i, val := range record.Values {
+				if i > 0 {
+					sb.WriteByte('\t')
+				}
+				sb.WriteString(p.formatCopyValue(val))
+			}
+			sb.WriteByte('\n')
+		}
+
+		sb.WriteString("\\.\n")
+	}
+
+	return sb.String(), nil
+}
+
+// GenerateUpdateStatements generates SQL UPDATE statements restoring
+// foreign keys which were inserted as NULL to break dependency cycles
+func (p *Parser) GenerateUpdateStatements(ctx context.Context, updates []DeferredUpdate) (string, error) {
+	var sb strings.Builder
+
+	for _, update := range updates {
+		sb.WriteString(buildUpdateStatement(update, p.formatValue) + ";\n")
+	}
+
+	return sb.String(), nil
+}
+
+// Build an UPDATE statement restoring a deferred foreign key, values are written by the given function
+func buildUpdateStatement(update DeferredUpdate, value func(interface{}) string) string {
+	assignments := make([]string, len(update.Columns))
+	for i, col := range update.Columns {
+		assignments[i] = fmt.Sprintf("%s = %s", col.Name, value(update.Values[i]))
+	}
+
+	conditions := make([]string, 0, len(update.Key.Columns)+len(update.Columns))
+	for i, col := range update.Key.Columns {
+		conditions = append(conditions, fmt.Sprintf("%s = %s", col.Name, value(update.Key.Values[i])))
+	}
+	// Rows which were skipped as already existing keep their own references
+	for _, col := range update.Columns {
+		conditions = append(conditions, fmt.Sprintf("%s IS NULL", col.Name))
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		update.Table.FullName(), strings.Join(assignments, ", "), strings.Join(conditions, " AND "))
+}
+
+// Build the ON CONFLICT clause for the configured conflict mode
+func (p *Parser) onConflictClause(table Table, columns []Column) string {
+	switch p.config.ConflictMode {
+	case ConflictDoNothing:
+		return " ON CONFLICT DO NOTHING"
+	case ConflictDoUpdate:
+		pkColumns, ok := p.TableToPKColumnsMap[table.FullName()]
+		if !ok {
+			// Without a primary key there is no conflict target to update on
+			return " ON CONFLICT DO NOTHING"
+		}
+		pkNames := make([]string, len(pkColumns))
+		for i, col := range pkColumns {
+			pkNames[i] = col.Name
+		}
+		var assignments []string
+		for _, col := range columns {
+			if !contains(pkNames, col.Name) {
+				assignments = append(assignments, fmt.Sprintf("%s = EXCLUDED.%s", col.Name, col.Name))
+			}
+		}
+		if len(assignments) == 0 {
+			return " ON CONFLICT DO NOTHING"
+		}
+		return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(pkNames, ", "), strings.Join(assignments, ", "))
+	default:
+		return ""
+	}
+}
+
+// Format a scanned value for the text format of COPY
+func (p *Parser) formatCopyValue(val interface{}) string {
+	if val == nil {
+		return `\N`
+	}
+	switch v := val.(type) {
+	case string:
+		return escapeCopyText(v)
+	case []byte:
+		// bytea in hex format, its backslash has to be escaped as well
+		return `\\x` + hex.EncodeToString(v)
+	case int16, int32, int, int64:
+		return fmt.Sprintf("%d", v)
+	case float32, float64:
+		return fmt.Sprintf("%g", v)
+	case bool:
+		if v {
+			return "t"
+		}
+		return "f"
+	case pgtype.Time:
+		return formatPgTime(v)
+	case pgtype.Numeric:
+		// Keep the exact value rather than a float approximation
+		text, err := v.Value()
+		if err != nil || text == nil {
+			n, _ := v.Float64Value()
+			return fmt.Sprintf("%g", n.Float64)
+		}
+		return text.(string)
+	case time.Time:
+		return v.Format("2006-01-02T15:04:05.999999Z07:00")
+	case map[string]interface{}, []interface{}:
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			p.logger.Printf("Error marshaling JSON: %v\n", err)
+			return escapeCopyText(fmt.Sprintf("%v", v))
+		}
+		return escapeCopyText(string(jsonBytes))
+	default:
+		p.logger.Printf("Unknown type: %T\n", v)
+		return escapeCopyText(fmt.Sprintf("%v", v))
+	}
+}
+
+// Escape characters which have a special meaning in the text format of COPY
+var copyTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\b", `\b`,
+	"\f", `\f`,
+	"\v", `\v`,
+)
+
+func escapeCopyText(s string) string {
+	return copyTextEscaper.Replace(s)
+}
+
+// Format a scanned value as an SQL literal
+func (p *Parser) formatValue(val interface{}) string {
+	if val == nil {
+		return "NULL"
+	}
+	switch v := val.(type) {
+	case string:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
+	case []byte:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(string(v), "'", "''"))
+	case int32:
+		return fmt.Sprintf("%d", v)
+	case int16:
+		return fmt.Sprintf("%d", v)
+	case pgtype.Time:
+		return fmt.Sprintf("'%s'", formatPgTime(v))
+	case pgtype.Numeric:
+		n, _ := v.Float64Value()
+		return fmt.Sprintf("%g", n.Float64)
+	case time.Time:
+		// Format time as ISO 8601 string
+		return fmt.Sprintf("'%s'", v.Format("2006-01-02T15:04:05.999999Z07:00"))
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float32:
+		return fmt.Sprintf("%g", v)
+	case float64:
+		return fmt.Sprintf("%g", v)
+	case int:
+		return fmt.Sprintf("%d", v)
+	case int64:
+		return fmt.Sprintf("%d", v)
+	case map[string]interface{}:
+		// Handle JSON data (OID 3614)
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			p.logger.Printf("Error marshaling JSON: %v\n", err)
+			return fmt.Sprintf("'%v'", v)
+		}
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(string(jsonBytes), "'", "''"))
+	case []interface{}:
+		// Handle JSON array
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			p.logger.Printf("Error marshaling JSON array: %v\n", err)
+			return fmt.Sprintf("'%v'", v)
+		}
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(string(jsonBytes), "'", "''"))
+	default:
+		p.logger.Printf("Unknown type: %T\n", v)
+		return fmt.Sprintf("%v", v)
+	}
+}
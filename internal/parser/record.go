@@ -14,15 +14,45 @@ type Record struct {
 	Values  []interface{}
 }
 
-type RecordVisit struct {
-	Query string
-	Args  []interface{}
-}
-
 func (r Record) String() string {
 	return fmt.Sprintf("{%s %+v %+v}", r.Table.FullName(), r.Columns, r.Values)
 }
 
+// Get values of the given columns, the second return value is false
+// if any of the columns is missing or NULL
+func (r Record) valuesOf(columns []Column) ([]interface{}, bool) {
+	values := make([]interface{}, 0, len(columns))
+	for _, relCol := range columns {
+		found := false
+		for i, col := range r.Columns {
+			if col.Name == relCol.Name {
+				if r.Values[i] == nil {
+					return nil, false
+				}
+				values = append(values, r.Values[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return values, len(values) > 0
+}
+
+// Get the primary key of the record
+func (r Record) primaryKey() PrimaryKey {
+	var pk PrimaryKey
+	for i, col := range r.Columns {
+		if col.IsPrimary {
+			pk.Columns = append(pk.Columns, col)
+			pk.Values = append(pk.Values, r.Values[i])
+		}
+	}
+	return pk
+}
+
 // Equal compares two Records for equality
 func (r Record) Equal(other Record) bool {
 	if r.Table.FullName() != other.Table.FullName() {
@@ -113,27 +143,6 @@ func (p *Parser) buildSelectColumnsQueryPart(columns []Column) string {
 	return strings.Join(selectColumns, ", ")
 }
 
-func (p *Parser) hasRecordVisit(query string, args []interface{}) bool {
-	for _, visit := range p.RecordVisits {
-		if visit.Query == query {
-			// Compare args if they exist
-			if len(visit.Args) == len(args) {
-				argsMatch := true
-				for i, arg := range visit.Args {
-					if arg != args[i] {
-						argsMatch = false
-						break
-					}
-				}
-				if argsMatch {
-					return true
-				}
-			}
-		}
-	}
-	return false
-}
-
 // Helper to fetch a single record by primary key
 func (p *Parser) FetchRecord(ctx context.Context, table Table, pk PrimaryKey) (Record, error) {
 	columns, err := p.getColumnsForTable(ctx, table)
@@ -141,17 +150,32 @@ func (p *Parser) FetchRecord(ctx context.Context, table Table, pk PrimaryKey) (R
 		return Record{}, fmt.Errorf("failed to get columns for table %s: %w", table.FullName(), err)
 	}
 
+	// Columns of the table tell whether the record is fetched by its primary key
+	if !p.visitRecord(hashKey(Table{Name: table.Name, Schema: table.Schema, Columns: columns}, pk.Columns, pk.Values), depth{}) {
+		return Record{}, ErrRecordAlreadyVisited
+	}
+
 	whereClause, args := pk.WhereClause()
 	selectColumns := p.buildSelectColumnsQueryPart(columns)
 	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", selectColumns, table.FullName(), whereClause)
 
-	if !p.hasRecordVisit(query, args) {
-		p.RecordVisits = append(p.RecordVisits, RecordVisit{Query: query, Args: args})
-	} else {
-		return Record{}, ErrRecordAlreadyVisited
+	return p.queryRecord(ctx, table, columns, query, args)
+}
+
+// Fetch a single record by primary key even if it was already visited
+func (p *Parser) fetchRecord(ctx context.Context, table Table, pk PrimaryKey) (Record, error) {
+	columns, err := p.getColumnsForTable(ctx, table)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to get columns for table %s: %w", table.FullName(), err)
 	}
 
-	row := p.pool.QueryRow(ctx, query, args...)
+	whereClause, args := pk.WhereClause()
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", p.buildSelectColumnsQueryPart(columns), table.FullName(), whereClause)
+	return p.queryRecord(ctx, table, columns, query, args)
+}
+
+func (p *Parser) queryRecord(ctx context.Context, table Table, columns []Column, query string, args []interface{}) (Record, error) {
+	row := p.querier().QueryRow(ctx, query, args...)
 
 	// Create a slice to hold the values
 	values := make([]interface{}, len(columns))
@@ -203,35 +227,145 @@ var allowedDataTypes = map[string]bool{
 	"bytea": true,
 }
 
-// Helper function to find all child records that reference the parent's PK
-func (p *Parser) findChildRecords(ctx context.Context, rel Relationship, parentPKValues []interface{}) ([]Record, error) {
+// Maximum number of keys looked up by a single query
+const maxLookupKeys = 1000
+
+// Creates a condition matching rows whose columns hold any of the keys, with the values of every column
+// passed as an array. Several columns are compared to the rows of their arrays unnested side by side.
+func keysCondition(columns []Column, keys [][]interface{}, firstArg int) (string, []interface{}) {
+	names := make([]string, len(columns))
+	arrays := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+
+	for i, col := range columns {
+		dataType := col.DataType
+		names[i] = col.Name
+		if !allowedDataTypes[dataType] {
+			dataType = "text"
+			names[i] = fmt.Sprintf("%s::text", col.Name)
+		}
+		arrays[i] = fmt.Sprintf("$%d::%s[]", firstArg+i, dataType)
+
+		values := make([]interface{}, len(keys))
+		for j, key := range keys {
+			values[j] = key[i]
+		}
+		args[i] = values
+	}
+
+	if len(columns) == 1 {
+		return fmt.Sprintf("%s = ANY(%s)", names[0], arrays[0]), args
+	}
+	return fmt.Sprintf("(%s) IN (SELECT * FROM unnest(%s))", strings.Join(names, ", "), strings.Join(arrays, ", ")), args
+}
+
+// Helper function to find the parent records referenced by any of the keys
+func (p *Parser) findParentRecords(ctx context.Context, rel Relationship, keys [][]interface{}) ([]Record, error) {
+	columns, err := p.getColumnsForTable(ctx, rel.TargetTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns for table %s: %w", rel.TargetTable.FullName(), err)
+	}
+
+	var records []Record
+	for start := 0; start < len(keys); start += maxLookupKeys {
+		condition, args := keysCondition(rel.TargetColumn, keys[start:min(start+maxLookupKeys, len(keys))], 1)
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+			p.buildSelectColumnsQueryPart(columns), rel.TargetTable.FullName(), condition)
+
+		found, err := p.queryRecords(ctx, rel.TargetTable, columns, query, args)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+	return records, nil
+}
+
+// Helper function to find all child records that reference any of the parent keys, children are
+// grouped by the encoded key they reference. Also returns the parents whose children were left out.
+func (p *Parser) findChildRecords(ctx context.Context, rel Relationship, parentKeys [][]interface{}) (map[string][]Record, []Truncation, error) {
+	children := make(map[string][]Record)
+	var truncations []Truncation
+	for start := 0; start < len(parentKeys); start += maxLookupKeys {
+		truncated, err := p.findChildRecordsOf(ctx, rel, parentKeys[start:min(start+maxLookupKeys, len(parentKeys))], children)
+		if err != nil {
+			return nil, nil, err
+		}
+		truncations = append(truncations, truncated...)
+	}
+	return children, truncations, nil
+}
+
+func (p *Parser) findChildRecordsOf(ctx context.Context, rel Relationship, parentKeys [][]interface{}, children map[string][]Record) ([]Truncation, error) {
 	// Build WHERE clause for the foreign key columns
-	conditions := make([]string, len(rel.SourceColumn))
-	for i, col := range rel.SourceColumn {
-		conditions[i] = fmt.Sprintf("%s = $%d", col.Name, i+1)
+	keyCondition, args := keysCondition(rel.SourceColumn, parentKeys, 1)
+	conditions := []string{keyCondition}
+	// Children of a polymorphic relationship also have to hold the type of the parent table
+	if rel.Discriminator != nil {
+		args = append(args, rel.Discriminator.Value)
+		conditions = append(conditions, fmt.Sprintf("%s::text = $%d", rel.Discriminator.Column.Name, len(args)))
 	}
 
+	columnNames := make([]string, len(rel.SourceTable.Columns))
 	selectColumns := make([]string, len(rel.SourceTable.Columns))
-
 	for i, col := range rel.SourceTable.Columns {
-		if allowedDataTypes[col.DataType] {
-			selectColumns[i] = col.Name
-		} else {
-			selectColumns[i] = fmt.Sprintf("%s::text AS %s", col.Name, col.Name)
-		}
+		columnNames[i] = col.Name
+		selectColumns[i] = selectChildColumn(col)
+	}
+	fkNames := make([]string, len(rel.SourceColumn))
+	fkColumns := make([]string, len(rel.SourceColumn))
+	for i, col := range rel.SourceColumn {
+		fkNames[i] = col.Name
+		fkColumns[i] = selectChildColumn(col)
 	}
-	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`,
-		strings.Join(selectColumns, ", "),
-		rel.SourceTable.FullName(),
-		strings.Join(conditions, " AND "))
 
-	rows, err := p.pool.Query(ctx, query, parentPKValues...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query child records: %w", err)
+	// Keep the children matching the row filter of their table
+	keyConditions := strings.Join(conditions, " AND ")
+	filter := p.config.rowFilter(rel.SourceTable)
+	if filter != "" {
+		conditions = append(conditions, fmt.Sprintf("(%s)", filter))
 	}
-	defer rows.Close()
 
-	var childRecords []Record
+	// Cap the fan-out of the relationship for every parent, one more row tells whether children were left out
+	limit, orderBy := p.config.childLimit(rel)
+	if limit > 0 && orderBy == "" {
+		orderBy = strings.Join(primaryKeyColumnNames(rel.SourceTable), ", ")
+	}
+
+	var query string
+	if limit > 0 {
+		query = fmt.Sprintf(`SELECT %s FROM (SELECT %s, row_number() OVER (PARTITION BY %s ORDER BY %s) AS traversql_row FROM %s WHERE %s) AS children WHERE traversql_row <= %d ORDER BY traversql_row`,
+			strings.Join(columnNames, ", "),
+			strings.Join(selectColumns, ", "),
+			strings.Join(fkNames, ", "),
+			orderBy,
+			rel.SourceTable.FullName(),
+			strings.Join(conditions, " AND "),
+			limit+1)
+	} else {
+		query = fmt.Sprintf(`SELECT %s FROM %s WHERE %s`,
+			strings.Join(selectColumns, ", "),
+			rel.SourceTable.FullName(),
+			strings.Join(conditions, " AND "))
+		if orderBy != "" {
+			query += " ORDER BY " + orderBy
+		}
+	}
+
+	var truncations []Truncation
+	if filter != "" {
+		filteredQuery := fmt.Sprintf(`SELECT DISTINCT %s FROM %s WHERE %s AND NOT COALESCE((%s), false)`,
+			strings.Join(fkColumns, ", "), rel.SourceTable.FullName(), keyConditions, filter)
+		filtered, err := p.queryKeys(ctx, filteredQuery, args, len(rel.SourceColumn))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check filtered child records: %w", err)
+		}
+		for _, key := range parentKeys {
+			if filtered[encodeKey(key)] {
+				truncations = append(truncations, Truncation{Relationship: rel, ParentKey: key, Reason: TruncatedByFilter})
+			}
+		}
+	}
 
 	// Get column information for the child table
 	columns, err := p.getColumnsForTable(ctx, rel.SourceTable)
@@ -239,6 +373,46 @@ func (p *Parser) findChildRecords(ctx context.Context, rel Relationship, parentP
 		return nil, fmt.Errorf("failed to get child table columns: %w", err)
 	}
 
+	records, err := p.queryRecords(ctx, rel.SourceTable, columns, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child records: %w", err)
+	}
+	for _, record := range records {
+		fkValues, _ := record.valuesOf(rel.SourceColumn)
+		key := encodeKey(fkValues)
+		children[key] = append(children[key], record)
+	}
+
+	if limit > 0 {
+		for _, parentKey := range parentKeys {
+			key := encodeKey(parentKey)
+			if len(children[key]) > limit {
+				children[key] = children[key][:limit]
+				truncations = append(truncations, Truncation{Relationship: rel, ParentKey: parentKey, Reason: TruncatedByLimit})
+			}
+		}
+	}
+
+	return truncations, nil
+}
+
+// Columns which can't be scanned directly are selected as text
+func selectChildColumn(col Column) string {
+	if allowedDataTypes[col.DataType] {
+		return col.Name
+	}
+	return fmt.Sprintf("%s::text AS %s", col.Name, col.Name)
+}
+
+// Run a query returning records of the table with the given columns
+func (p *Parser) queryRecords(ctx context.Context, table Table, columns []Column, query string, args []interface{}) ([]Record, error) {
+	rows, err := p.querier().Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
 	for rows.Next() {
 		// Create value pointers for scanning
 		values := make([]interface{}, len(columns))
@@ -248,47 +422,41 @@ func (p *Parser) findChildRecords(ctx context.Context, rel Relationship, parentP
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan child record: %w", err)
+			return nil, fmt.Errorf("failed to scan record: %w", err)
 		}
 
-		childRecords = append(childRecords, Record{
-			Table:   rel.SourceTable,
+		records = append(records, Record{
+			Table:   table,
 			Columns: columns,
 			Values:  values,
 		})
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating child records: %w", err)
+		return nil, fmt.Errorf("error iterating records: %w", err)
 	}
-
-	return childRecords, nil
+	return records, nil
 }
 
-func (p *Parser) tryAddRecord(records *[]Record, newRecord Record) {
-	if !p.recordExists(*records, newRecord) {
-		*records = append(*records, newRecord)
+// Run a query returning keys of the given number of columns, keys are returned encoded
+func (p *Parser) queryKeys(ctx context.Context, query string, args []interface{}, size int) (map[string]bool, error) {
+	rows, err := p.querier().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
-}
+	defer rows.Close()
 
-// Helper to check if a record already exists in the collection
-func (p *Parser) recordExists(records []Record, newRecord Record) bool {
-	for _, r := range records {
-		if r.Table.FullName() == newRecord.Table.FullName() {
-			// Compare primary key values
-			match := true
-			for i, col := range r.Columns {
-				if col.IsPrimary {
-					if r.Values[i] != newRecord.Values[i] {
-						match = false
-						break
-					}
-				}
-			}
-			if match {
-				return true
-			}
+	keys := make(map[string]bool)
+	for rows.Next() {
+		values := make([]interface{}, size)
+		valuePtrs := make([]interface{}, size)
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
 		}
+		keys[encodeKey(values)] = true
 	}
-	return false
+	return keys, rows.Err()
 }
@@ -1,8 +1,8 @@
 package parser
 
 import (
-	"context"
 	"fmt"
+	"strings"
 )
 
 type RelationType string
@@ -22,180 +22,138 @@ const (
 
 // Represents a foreign key relationship
 type Relationship struct {
+	// Name of the foreign key constraint
+	Name         string
 	SourceTable  Table
 	SourceColumn []Column
 	TargetTable  Table
 	TargetColumn []Column
 	RelationType RelationType
+	// Declared in config rather than as a constraint of the database
+	Virtual bool
+	// Set for a target of a polymorphic relationship
+	Discriminator *Discriminator
+}
+
+// Condition on the type column of a polymorphic relationship, only source
+// records holding the value reference the target table of the relationship
+type Discriminator struct {
+	Column Column
+	Value  string
 }
 
 func (r Relationship) String() string {
 	return fmt.Sprintf("%s | %s.%+v -> %s.%+v", r.RelationType, r.SourceTable.FullName(), r.SourceColumn, r.TargetTable.FullName(), r.TargetColumn)
 }
 
-// Track of visited tables and also direction of that visit
-type RelationshipVisit struct {
-	TableFrom Table
-	TableTo   Table
+// Check whether the source record references the target table of the relationship,
+// which is always the case unless the relationship is polymorphic
+func (r Relationship) appliesTo(record Record) bool {
+	if r.Discriminator == nil {
+		return true
+	}
+	values, ok := record.valuesOf([]Column{r.Discriminator.Column})
+	return ok && fmt.Sprint(values[0]) == r.Discriminator.Value
 }
 
-func (p *Parser) discoverRelationships(ctx context.Context) ([]Relationship, error) {
-	query := `
-        SELECT
-            tc.table_schema as source_schema,
-            tc.table_name as source_table,
-            kcu.column_name as source_column,
-            ccu.table_schema as target_schema,
-            ccu.table_name as target_table,
-            ccu.column_name as target_column,
-            tc.constraint_name,
-            kcu.ordinal_position,
-            (SELECT COUNT(*) FROM information_schema.table_constraints WHERE constraint_name = tc.constraint_name) as constraint_count,
-            (SELECT COUNT(*) FROM information_schema.key_column_usage WHERE constraint_name = tc.constraint_name) as columns_in_constraint,
-            (SELECT COUNT(*)
-            FROM information_schema.table_constraints tc2
-            JOIN information_schema.key_column_usage kcu2 ON tc2.constraint_name = kcu2.constraint_name
-            WHERE tc2.constraint_type = 'PRIMARY KEY'
-            AND kcu2.table_schema = ccu.table_schema
-            AND kcu2.table_name = ccu.table_name
-            AND kcu2.column_name = ccu.column_name) as is_target_pk,
-            (SELECT COUNT(*)
-            FROM information_schema.table_constraints tc3
-            JOIN information_schema.key_column_usage kcu3 ON tc3.constraint_name = kcu3.constraint_name
-            WHERE tc3.constraint_type = 'UNIQUE'
-            AND kcu3.table_schema = ccu.table_schema
-            AND kcu3.table_name = ccu.table_name
-            AND kcu3.column_name = ccu.column_name) as is_target_unique
-        FROM
-            information_schema.table_constraints tc
-            JOIN information_schema.key_column_usage kcu
-                ON tc.constraint_name = kcu.constraint_name
-                AND tc.table_schema = kcu.table_schema
-                AND tc.table_name = kcu.table_name
-            JOIN information_schema.constraint_column_usage ccu
-                ON ccu.constraint_name = tc.constraint_name
-                AND ccu.table_schema = tc.table_schema
-        WHERE
-            tc.constraint_type = 'FOREIGN KEY'
-            AND tc.table_schema = ANY($1)
-    `
-
-	rows, err := p.pool.Query(ctx, query, p.config.Schemas)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query relationships: %w", err)
+// Describe a relationship by its columns, e.g. `user_id -> id`
+func relationshipColumnsLabel(rel Relationship) string {
+	source := make([]string, len(rel.SourceColumn))
+	for i, col := range rel.SourceColumn {
+		source[i] = col.Name
 	}
-	defer rows.Close()
+	target := make([]string, len(rel.TargetColumn))
+	for i, col := range rel.TargetColumn {
+		target[i] = col.Name
+	}
+	label := fmt.Sprintf("%s -> %s", strings.Join(source, ", "), strings.Join(target, ", "))
+	if rel.Discriminator != nil {
+		label += fmt.Sprintf(" where %s = %s", rel.Discriminator.Column.Name, rel.Discriminator.Value)
+	}
+	return label
+}
 
-	var relationships []Relationship
-	for rows.Next() {
-		var sourceSchema, sourceTable, sourceColumn, targetSchema, targetTable, targetColumn, constraintName string
-		var ordinalPosition, constraintCount, columnsInConstraint, isTargetPK, isTargetUnique int
-		if err := rows.Scan(
-			&sourceSchema, &sourceTable, &sourceColumn,
-			&targetSchema, &targetTable, &targetColumn,
-			&constraintName, &ordinalPosition, &constraintCount, &columnsInConstraint,
-			&isTargetPK, &isTargetUnique,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan relationship row: %w", err)
-		}
+// Track of visited tables and also direction of that visit, tables are keyed by their full names
+type relationshipVisit struct {
+	tableFrom string
+	tableTo   string
+}
 
+func (p *Parser) discoverRelationships(cat *catalog) ([]Relationship, error) {
+	var relationships []Relationship
+	for _, fk := range cat.foreignKeys {
 		// Skip if source or target table is excluded
-		if contains(p.config.ExcludedTables, sourceTable) || contains(p.config.ExcludedTables, targetTable) {
+		if contains(p.config.ExcludedTables, fk.sourceTable) || contains(p.config.ExcludedTables, fk.targetTable) {
 			continue
 		}
 		// Skip if included tables are specified and either source or target is not included
 		if len(p.config.IncludedTables) > 0 &&
-			(!contains(p.config.IncludedTables, sourceTable) || !contains(p.config.IncludedTables, targetTable)) {
+			(!contains(p.config.IncludedTables, fk.sourceTable) || !contains(p.config.IncludedTables, fk.targetTable)) {
 			continue
 		}
 
 		// Get source and target tables
-		sourceTableObj, err := p.getTable(sourceSchema, sourceTable)
+		sourceTableObj, err := p.getTable(fk.sourceSchema, fk.sourceTable)
 		if err != nil {
 			return nil, err
 		}
-		targetTableObj, err := p.getTable(targetSchema, targetTable)
+		targetTableObj, err := p.getTable(fk.targetSchema, fk.targetTable)
 		if err != nil {
 			return nil, err
 		}
+		sourceCatalogTable := cat.tablesByOID[fk.sourceOID]
+		targetCatalogTable := cat.tablesByOID[fk.targetOID]
 
-		// Find source and target columns
-		var sourceCol, targetCol Column
-		for _, col := range sourceTableObj.Columns {
-			if col.Name == sourceColumn {
-				sourceCol = col
-				break
-			}
+		// Source and target columns are paired in the order they are declared in the constraint
+		sourceCols, err := sourceCatalogTable.columnsOf(fk.sourceAttnums)
+		if err != nil {
+			return nil, err
 		}
-		for _, col := range targetTableObj.Columns {
-			if col.Name == targetColumn {
-				targetCol = col
-				break
-			}
+		targetCols, err := targetCatalogTable.columnsOf(fk.targetAttnums)
+		if err != nil {
+			return nil, err
 		}
 
-		var relType RelationType
-
-		// Check if this is a self-referencing relationship
-		if sourceTable == targetTable {
-			relType = SelfReferencing
-		} else {
-			// Check if target column is a primary key or has a unique constraint
-			isTargetKeyUnique := isTargetPK > 0 || isTargetUnique > 0
-
-			// Get information about source column uniqueness
-			var isSourceKeyUnique bool
-			err := p.pool.QueryRow(ctx, `
-               SELECT COUNT(*) > 0
-               FROM information_schema.table_constraints tc
-               JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name
-               WHERE (tc.constraint_type = 'PRIMARY KEY' OR tc.constraint_type = 'UNIQUE')
-               AND kcu.table_schema = $1 AND kcu.table_name = $2 AND kcu.column_name = $3
-           `, sourceSchema, sourceTable, sourceColumn).Scan(&isSourceKeyUnique)
-
-			if err != nil {
-				return nil, fmt.Errorf("failed to check source column uniqueness: %w", err)
-			}
-
-			// Determine relationship type based on column uniqueness
-			if isSourceKeyUnique && isTargetKeyUnique {
-				relType = OneToOne
-			} else if isSourceKeyUnique && !isTargetKeyUnique {
-				relType = OneToMany
-			} else if !isSourceKeyUnique && isTargetKeyUnique {
-				relType = ManyToOne
-			} else {
-				relType = ManyToMany
-			}
-		}
+		// Check if key columns are part of a primary key or a unique constraint
+		relType := relationTypeOf(fk.sourceOID == fk.targetOID,
+			sourceCatalogTable.areColumnsUnique(fk.sourceAttnums),
+			targetCatalogTable.areColumnsUnique(fk.targetAttnums))
 
 		rel := Relationship{
+			Name:         fk.name,
 			SourceTable:  sourceTableObj,
-			SourceColumn: []Column{sourceCol},
+			SourceColumn: sourceCols,
 			TargetTable:  targetTableObj,
-			TargetColumn: []Column{targetCol},
+			TargetColumn: targetCols,
 			RelationType: relType,
 		}
 
 		relationships = append(relationships, rel)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating relationship rows: %w", err)
-	}
-
 	return relationships, nil
 }
 
+// Determine relationship type based on uniqueness of the source and target columns
+func relationTypeOf(selfReferencing, isSourceKeyUnique, isTargetKeyUnique bool) RelationType {
+	switch {
+	case selfReferencing:
+		return SelfReferencing
+	case isSourceKeyUnique && isTargetKeyUnique:
+		return OneToOne
+	case isSourceKeyUnique && !isTargetKeyUnique:
+		return OneToMany
+	case !isSourceKeyUnique && isTargetKeyUnique:
+		return ManyToOne
+	default:
+		return ManyToMany
+	}
+}
+
 func (s *Parser) addRelationshipVisit(from, to Table) {
-	s.RelationshipVisits = append(s.RelationshipVisits, RelationshipVisit{TableFrom: from, TableTo: to})
+	s.visitedRelationships.visit(relationshipVisit{tableFrom: from.FullName(), tableTo: to.FullName()})
 }
 
 func (s *Parser) hasRelationshipVisit(from, to Table) bool {
-	for _, visit := range s.RelationshipVisits {
-		if visit.TableFrom.Name == from.Name && visit.TableTo.Name == to.Name {
-			return true
-		}
-	}
-	return false
+	return s.visitedRelationships.has(relationshipVisit{tableFrom: from.FullName(), tableTo: to.FullName()})
 }
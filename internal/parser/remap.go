@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// How primary keys of extracted records are rewritten
+type KeyRemapMode string
+
+const (
+	// Keep primary keys as they are
+	KeyRemapNone KeyRemapMode = "none"
+	// Add the configured offset to integer primary keys
+	KeyRemapOffset KeyRemapMode = "offset"
+	// Take integer primary keys from the next values of the sequence of their column
+	KeyRemapSequence KeyRemapMode = "sequence"
+	// Replace uuid primary keys with fresh random UUIDs
+	KeyRemapUUID KeyRemapMode = "uuid"
+)
+
+// ParseKeyRemapMode converts a string to a KeyRemapMode
+func ParseKeyRemapMode(s string) (KeyRemapMode, error) {
+	switch mode := KeyRemapMode(s); mode {
+	case KeyRemapNone, KeyRemapOffset, KeyRemapSequence, KeyRemapUUID:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown key remap mode %q", s)
+	}
+}
+
+var integerDataTypes = map[string]bool{
+	"smallint": true,
+	"integer":  true,
+	"bigint":   true,
+}
+
+// Check whether the primary key column is rewritten by the mode
+func (m KeyRemapMode) remaps(col Column) bool {
+	switch m {
+	case KeyRemapOffset, KeyRemapSequence:
+		return integerDataTypes[col.DataType]
+	case KeyRemapUUID:
+		return col.DataType == "uuid"
+	default:
+		return false
+	}
+}
+
+// Rewrite primary keys of the records according to the configured mode, and every foreign key
+// referencing them along with it. Sequences are advanced in the given pool, which must be the
+// database the records are loaded into.
+//
+// Primary key columns which are foreign keys themselves, as in one-to-one tables, take the new
+// key of the record they reference. Foreign keys referencing records outside of the graph keep
+// their values, they point at rows which already exist.
+func (p *Parser) remapKeys(ctx context.Context, pool *pgxpool.Pool, records []Record) ([]Record, error) {
+	mode := p.config.KeyRemap
+	if mode == "" || mode == KeyRemapNone {
+		return records, nil
+	}
+
+	// Columns of every table taking part in a relationship as a foreign key
+	foreignKeys := make(map[string]bool)
+	referenced := make(map[string]bool)
+	for _, rel := range p.Relationships {
+		for i := range rel.SourceColumn {
+			foreignKeys[columnKey(rel.SourceTable, rel.SourceColumn[i])] = true
+			referenced[columnKey(rel.TargetTable, rel.TargetColumn[i])] = true
+		}
+	}
+
+	// New values by column and old value, looked up by foreign keys referencing the column
+	mapping := make(map[string]map[string]interface{})
+	setMapping := func(table Table, col Column, old, new interface{}) {
+		key := columnKey(table, col)
+		if mapping[key] == nil {
+			mapping[key] = make(map[string]interface{})
+		}
+		mapping[key][fmt.Sprint(old)] = new
+	}
+	remapsKey := func(table Table, col Column, value interface{}) bool {
+		return col.IsPrimary && value != nil && mode.remaps(col) && !foreignKeys[columnKey(table, col)]
+	}
+
+	// Collect the distinct keys of every column first, so new keys are taken in one go per column.
+	// Records may be collected more than once through different entry records.
+	type keyColumn struct {
+		table Table
+		col   Column
+		olds  []interface{}
+		seen  map[string]bool
+	}
+	var columns []*keyColumn
+	byKey := make(map[string]*keyColumn)
+	for _, record := range records {
+		for j, col := range record.Columns {
+			if !remapsKey(record.Table, col, record.Values[j]) {
+				continue
+			}
+			kc, ok := byKey[columnKey(record.Table, col)]
+			if !ok {
+				kc = &keyColumn{table: record.Table, col: col, seen: make(map[string]bool)}
+				byKey[columnKey(record.Table, col)] = kc
+				columns = append(columns, kc)
+			}
+			if old := fmt.Sprint(record.Values[j]); !kc.seen[old] {
+				kc.seen[old] = true
+				kc.olds = append(kc.olds, record.Values[j])
+			}
+		}
+	}
+	for _, kc := range columns {
+		news, err := p.newKeys(ctx, pool, kc.table, kc.col, kc.olds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remap primary key of %s: %w", kc.table.FullName(), err)
+		}
+		for i, old := range kc.olds {
+			setMapping(kc.table, kc.col, old, news[i])
+		}
+	}
+
+	remapped := make([]Record, len(records))
+	for i, record := range records {
+		remapped[i] = record
+		remapped[i].Values = append([]interface{}(nil), record.Values...)
+		for j, col := range record.Columns {
+			if remapsKey(record.Table, col, record.Values[j]) {
+				remapped[i].Values[j] = mapping[columnKey(record.Table, col)][fmt.Sprint(record.Values[j])]
+			}
+		}
+	}
+
+	// Follow foreign keys until keys derived from other keys are rewritten as well
+	for changed := true; changed; {
+		changed = false
+		for i, record := range records {
+			for _, rel := range p.Relationships {
+				if rel.SourceTable.FullName() != record.Table.FullName() || !rel.appliesTo(record) {
+					continue
+				}
+				for k, sourceCol := range rel.SourceColumn {
+					j := columnIndex(record.Columns, sourceCol.Name)
+					if j < 0 || record.Values[j] == nil {
+						continue
+					}
+					new, ok := mapping[columnKey(rel.TargetTable, rel.TargetColumn[k])][fmt.Sprint(record.Values[j])]
+					if !ok || fmt.Sprint(remapped[i].Values[j]) == fmt.Sprint(new) {
+						continue
+					}
+					remapped[i].Values[j] = new
+					changed = true
+					if referenced[columnKey(record.Table, sourceCol)] {
+						setMapping(record.Table, sourceCol, record.Values[j], new)
+					}
+				}
+			}
+		}
+	}
+
+	return remapped, nil
+}
+
+// Get new primary key values for the given values of the column according to the configured mode
+func (p *Parser) newKeys(ctx context.Context, pool *pgxpool.Pool, table Table, col Column, olds []interface{}) ([]interface{}, error) {
+	news := make([]interface{}, len(olds))
+	switch p.config.KeyRemap {
+	case KeyRemapOffset:
+		for i, old := range olds {
+			new, err := offsetKey(old, p.config.KeyOffset)
+			if err != nil {
+				return nil, err
+			}
+			news[i] = new
+		}
+	case KeyRemapSequence:
+		if pool == nil {
+			return nil, ErrNoSequencePool
+		}
+		// A single round trip per column rather than per record
+		rows, err := pool.Query(ctx, "SELECT nextval(pg_get_serial_sequence($1, $2)) FROM generate_series(1, $3)",
+			table.FullName(), col.Name, len(olds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next values of the sequence of column %s: %w", col.Name, err)
+		}
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			var next *int64
+			if err := rows.Scan(&next); err != nil {
+				return nil, fmt.Errorf("failed to scan next value of the sequence of column %s: %w", col.Name, err)
+			}
+			if next == nil {
+				return nil, fmt.Errorf("column %s has no sequence", col.Name)
+			}
+			news[n] = *next
+			n++
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to get next values of the sequence of column %s: %w", col.Name, err)
+		}
+	case KeyRemapUUID:
+		for i := range olds {
+			news[i] = uuid.NewString()
+		}
+	default:
+		copy(news, olds)
+	}
+	return news, nil
+}
+
+// Add the offset to an integer key, keeping its type
+func offsetKey(old interface{}, offset int64) (interface{}, error) {
+	var value, max int64
+	switch v := old.(type) {
+	case int16:
+		value, max = int64(v), math.MaxInt16
+	case int32:
+		value, max = int64(v), math.MaxInt32
+	case int64:
+		value, max = v, math.MaxInt64
+	case int:
+		value, max = int64(v), math.MaxInt
+	default:
+		return nil, fmt.Errorf("unable to offset key %v of type %T", old, old)
+	}
+	if (offset > 0 && value > max-offset) || (offset < 0 && value < -max-offset) {
+		return nil, fmt.Errorf("key %d with offset %d is out of range", value, offset)
+	}
+	switch old.(type) {
+	case int16:
+		return int16(value + offset), nil
+	case int32:
+		return int32(value + offset), nil
+	case int:
+		return int(value + offset), nil
+	default:
+		return value + offset, nil
+	}
+}
+
+// Get the position of the named column, -1 when there is none
+func columnIndex(columns []Column, name string) int {
+	for i, col := range columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
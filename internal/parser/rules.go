@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule enabling or disabling relationships in either direction of the traversal.
+//
+// Match is either a constraint name or a `source.table.column -> target.table` pattern,
+// where the source may also be `table`, `table.column` or `schema.table.column` and the
+// target `table` or `schema.table`. Every part of a match may contain glob wildcards.
+type RelationshipRule struct {
+	Match string `yaml:"match"`
+	// Whether to follow matching relationships from child records to their parents, nil keeps the default
+	Parents *bool `yaml:"parents"`
+	// Whether to follow matching relationships from parent records to their children, nil keeps the default
+	Children *bool `yaml:"children"`
+	// Maximum number of children followed per parent record, 0 means unlimited
+	Limit int `yaml:"limit"`
+	// ORDER BY expression picking the children kept by the limit, the primary key by default
+	OrderBy string `yaml:"order_by"`
+}
+
+// Validate checks that the match of the rule is a valid pattern
+func (r RelationshipRule) Validate() error {
+	_, err := r.compile()
+	return err
+}
+
+// Check the rule and parse its match
+func (r RelationshipRule) compile() (compiledRule, error) {
+	if strings.TrimSpace(r.Match) == "" {
+		return compiledRule{}, fmt.Errorf("match is empty")
+	}
+	if r.Parents == nil && r.Children == nil && r.Limit == 0 && r.OrderBy == "" {
+		return compiledRule{}, fmt.Errorf("rule %q doesn't set parents, children, limit or order_by", r.Match)
+	}
+	if r.Limit < 0 {
+		return compiledRule{}, fmt.Errorf("rule %q has a negative limit", r.Match)
+	}
+	pattern, err := parseRulePattern(r.Match)
+	if err != nil {
+		return compiledRule{}, fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	return compiledRule{RelationshipRule: r, pattern: pattern}, nil
+}
+
+// Relationship rule with its parsed match, so that the match isn't parsed on every relationship check
+type compiledRule struct {
+	RelationshipRule
+	pattern rulePattern
+}
+
+// Parts of a rule match, every part is a glob pattern
+type rulePattern struct {
+	constraint   string
+	sourceSchema string
+	sourceTable  string
+	sourceColumn string
+	targetSchema string
+	targetTable  string
+}
+
+func parseRulePattern(match string) (rulePattern, error) {
+	source, target, isPattern := strings.Cut(match, "->")
+	if !isPattern {
+		pattern := rulePattern{constraint: strings.TrimSpace(match)}
+		_, err := path.Match(pattern.constraint, "")
+		return pattern, err
+	}
+
+	pattern := rulePattern{sourceSchema: "*", sourceColumn: "*", targetSchema: "*"}
+	sourceParts := strings.Split(strings.TrimSpace(source), ".")
+	switch len(sourceParts) {
+	case 1:
+		pattern.sourceTable = sourceParts[0]
+	case 2:
+		pattern.sourceTable, pattern.sourceColumn = sourceParts[0], sourceParts[1]
+	case 3:
+		pattern.sourceSchema, pattern.sourceTable, pattern.sourceColumn = sourceParts[0], sourceParts[1], sourceParts[2]
+	default:
+		return rulePattern{}, fmt.Errorf("source must be table, table.column or schema.table.column")
+	}
+	targetParts := strings.Split(strings.TrimSpace(target), ".")
+	switch len(targetParts) {
+	case 1:
+		pattern.targetTable = targetParts[0]
+	case 2:
+		pattern.targetSchema, pattern.targetTable = targetParts[0], targetParts[1]
+	default:
+		return rulePattern{}, fmt.Errorf("target must be table or schema.table")
+	}
+
+	for _, part := range []string{pattern.sourceSchema, pattern.sourceTable, pattern.sourceColumn, pattern.targetSchema, pattern.targetTable} {
+		if part == "" {
+			return rulePattern{}, fmt.Errorf("pattern has an empty part")
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return rulePattern{}, err
+		}
+	}
+	return pattern, nil
+}
+
+// Check whether the pattern applies to the given relationship
+func (pattern rulePattern) matches(rel Relationship) bool {
+	if pattern.constraint != "" {
+		return globMatch(pattern.constraint, rel.Name)
+	}
+
+	if !globMatch(pattern.sourceSchema, rel.SourceTable.Schema) || !globMatch(pattern.sourceTable, rel.SourceTable.Name) ||
+		!globMatch(pattern.targetSchema, rel.TargetTable.Schema) || !globMatch(pattern.targetTable, rel.TargetTable.Name) {
+		return false
+	}
+	// A composite foreign key matches when any of its columns does
+	for _, col := range rel.SourceColumn {
+		if globMatch(pattern.sourceColumn, col.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func globMatch(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// Check whether the relationship is followed from child records to their parents,
+// the last matching rule wins over earlier ones and the FollowParents default
+func (c *parserConfig) followsParents(rel Relationship) bool {
+	follow := c.FollowParents
+	for _, rule := range c.rules {
+		if rule.Parents != nil && rule.pattern.matches(rel) {
+			follow = *rule.Parents
+		}
+	}
+	return follow
+}
+
+// Check whether the relationship is followed from parent records to their children,
+// the last matching rule wins over earlier ones and the FollowChildren default
+func (c *parserConfig) followsChildren(rel Relationship) bool {
+	follow := c.FollowChildren
+	for _, rule := range c.rules {
+		if rule.Children != nil && rule.pattern.matches(rel) {
+			follow = *rule.Children
+		}
+	}
+	return follow
+}
+
+// Validate the relationship rules and keep them with their parsed matches
+func (c *parserConfig) compileRelationshipRules() error {
+	c.rules = make([]compiledRule, 0, len(c.RelationshipRules))
+	for i, rule := range c.RelationshipRules {
+		compiled, err := rule.compile()
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+	return nil
+}
+
+// LoadRelationshipRules reads a list of relationship rules from a YAML or JSON file
+func LoadRelationshipRules(file string) ([]RelationshipRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RelationshipRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode relationship rules: %w", err)
+	}
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("relationship rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,76 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestRelationshipRules(t *testing.T) {
+	follow, skip := true, false
+
+	t.Run("should validate rules", func(t *testing.T) {
+		testCases := []struct {
+			name        string
+			rule        parser.RelationshipRule
+			expectError bool
+		}{
+			{name: "Constraint name", rule: parser.RelationshipRule{Match: "fk_orders_user", Parents: &follow}},
+			{name: "Table pattern", rule: parser.RelationshipRule{Match: "audit_log -> users", Children: &skip}},
+			{name: "Column pattern", rule: parser.RelationshipRule{Match: "audit_log.user_id -> users", Children: &skip}},
+			{name: "Schema pattern", rule: parser.RelationshipRule{Match: "public.audit_*.* -> public.users", Children: &skip}},
+			{name: "Limit", rule: parser.RelationshipRule{Match: "events -> customers", Limit: 100, OrderBy: "created_at DESC"}},
+			{name: "Negative limit", rule: parser.RelationshipRule{Match: "events -> customers", Limit: -1}, expectError: true},
+			{name: "Empty match", rule: parser.RelationshipRule{Match: " ", Children: &skip}, expectError: true},
+			{name: "No direction", rule: parser.RelationshipRule{Match: "fk_orders_user"}, expectError: true},
+			{name: "Too many source parts", rule: parser.RelationshipRule{Match: "a.b.c.d -> users", Children: &skip}, expectError: true},
+			{name: "Too many target parts", rule: parser.RelationshipRule{Match: "orders -> a.b.c", Children: &skip}, expectError: true},
+			{name: "Empty target", rule: parser.RelationshipRule{Match: "orders -> ", Children: &skip}, expectError: true},
+			{name: "Malformed glob", rule: parser.RelationshipRule{Match: "orders[ -> users", Children: &skip}, expectError: true},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				err := tc.rule.Validate()
+				if tc.expectError {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	})
+
+	t.Run("should load rules from a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rules.yaml")
+		err := os.WriteFile(path, []byte(`
+- match: audit_log.user_id -> users
+  children: false
+- match: fk_orders_user
+  parents: true
+  children: true
+`), 0o644)
+		assert.NoError(t, err)
+
+		rules, err := parser.LoadRelationshipRules(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []parser.RelationshipRule{
+				{Match: "audit_log.user_id -> users", Children: &skip},
+				{Match: "fk_orders_user", Parents: &follow, Children: &follow},
+			}, rules)
+		}
+	})
+
+	t.Run("should name the invalid rule of a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		err := os.WriteFile(path, []byte(`[{"match": "orders -> users", "parents": false}, {"match": "orders"}]`), 0o644)
+		assert.NoError(t, err)
+
+		_, err = parser.LoadRelationshipRules(path)
+		assert.ErrorContains(t, err, "relationship rule 2")
+	})
+}
@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// Hash of the table and primary key of a record
+type recordHash [16]byte
+
+func hashRecordKey(table Table, values []interface{}) recordHash {
+	return hashParts(table.FullName(), "", encodeKey(values))
+}
+
+func hashRecord(record Record) recordHash {
+	return hashRecordKey(record.Table, record.primaryKey().Values)
+}
+
+// Hash of the values of a key of the table. Values of the primary key hash the same
+// as the record holding them, other unique keys are told apart by their column names.
+func hashKey(table Table, columns []Column, values []interface{}) recordHash {
+	if pkValues, ok := primaryKeyValuesOf(table, columns, values); ok {
+		return hashRecordKey(table, pkValues)
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return hashParts(table.FullName(), strings.Join(names, ","), encodeKey(values))
+}
+
+func hashParts(parts ...string) recordHash {
+	h := fnv.New128a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	var sum recordHash
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// Keys visited by a traversal, safe for concurrent use
+type visitSet[K comparable] struct {
+	mu   sync.Mutex
+	keys map[K]struct{}
+}
+
+func newVisitSet[K comparable]() *visitSet[K] {
+	return &visitSet[K]{keys: make(map[K]struct{})}
+}
+
+// Mark the key as visited, the result is false when it already was
+func (v *visitSet[K]) visit(key K) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.keys[key]; ok {
+		return false
+	}
+	v.keys[key] = struct{}{}
+	return true
+}
+
+func (v *visitSet[K]) has(key K) bool {
+	if v == nil {
+		return false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, ok := v.keys[key]
+	return ok
+}
+
+// Records collected by a traversal, deduplicated by a hash of their primary key.
+// Records are either kept or handed to a sink as they are added, then only their
+// hashes are kept.
+type recordSet struct {
+	// Position of every added record by its hash
+	positions map[recordHash]int
+	// Position of every added record by the hashes of its indexed keys
+	keys map[recordHash]int
+	// Keys other than the primary key which are indexed, by table
+	indexedKeys map[string][][]Column
+	// Added records, only kept without a sink
+	records []Record
+	sink    func(ctx context.Context, record Record, position int) error
+}
+
+func newRecordSet(records []Record) *recordSet {
+	s := &recordSet{positions: make(map[recordHash]int, len(records))}
+	for _, record := range records {
+		if _, ok := s.insert(record); ok {
+			s.records = append(s.records, record)
+		}
+	}
+	return s
+}
+
+// Create a set passing records to the sink instead of keeping them. Records can only be found
+// by their primary key and the given keys once they aren't kept.
+func newStreamingRecordSet(sink func(ctx context.Context, record Record, position int) error, keys map[string][][]Column) *recordSet {
+	return &recordSet{positions: make(map[recordHash]int), keys: make(map[recordHash]int), indexedKeys: keys, sink: sink}
+}
+
+func (s *recordSet) contains(record Record) bool {
+	_, ok := s.positions[hashRecord(record)]
+	return ok
+}
+
+// Add the record unless a record with the same primary key was already added
+func (s *recordSet) add(ctx context.Context, record Record) error {
+	position, ok := s.insert(record)
+	if !ok {
+		return nil
+	}
+	if s.sink != nil {
+		return s.sink(ctx, record, position)
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Index the record, the second return value is false when it already was
+func (s *recordSet) insert(record Record) (int, bool) {
+	hash := hashRecord(record)
+	if _, ok := s.positions[hash]; ok {
+		return 0, false
+	}
+	position := len(s.positions)
+	s.positions[hash] = position
+	for _, columns := range s.indexedKeys[record.Table.FullName()] {
+		if values, ok := record.valuesOf(columns); ok {
+			if _, ok := s.keys[hashKey(record.Table, columns, values)]; !ok {
+				s.keys[hashKey(record.Table, columns, values)] = position
+			}
+		}
+	}
+	return position, true
+}
+
+// Get the position of the record of the table whose columns hold the given values. Other keys
+// than the primary key and the indexed keys are looked up in the kept records, so they can't be
+// found once records are passed to a sink.
+func (s *recordSet) find(table Table, columns []Column, values []interface{}) (int, bool) {
+	if position, ok := s.findHash(hashKey(table, columns, values)); ok {
+		return position, true
+	}
+	key := encodeKey(values)
+	for i, record := range s.records {
+		if record.Table.FullName() != table.FullName() {
+			continue
+		}
+		if recordValues, ok := record.valuesOf(columns); ok && encodeKey(recordValues) == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Get the position of the record with the given hash of its primary key or of an indexed key
+func (s *recordSet) findHash(hash recordHash) (int, bool) {
+	if position, ok := s.positions[hash]; ok {
+		return position, true
+	}
+	position, ok := s.keys[hash]
+	return position, ok
+}
+
+// Arrange values of the given columns in the order of the primary key of the table,
+// the second return value is false unless the columns are exactly the primary key
+func primaryKeyValuesOf(table Table, columns []Column, values []interface{}) ([]interface{}, bool) {
+	pk := primaryKeyColumnNames(table)
+	if len(pk) == 0 || len(pk) != len(columns) {
+		return nil, false
+	}
+	pkValues := make([]interface{}, len(pk))
+	for i, name := range pk {
+		j := columnIndex(columns, name)
+		if j < 0 {
+			return nil, false
+		}
+		pkValues[i] = values[j]
+	}
+	return pkValues, true
+}
+
+// Keys other than the primary key referenced by relationships, by table
+func (p *Parser) referencedKeys() map[string][][]Column {
+	keys := make(map[string][][]Column)
+	seen := make(map[string]bool)
+	for _, rel := range p.Relationships {
+		if isPrimaryKey(rel.TargetTable, rel.TargetColumn) {
+			continue
+		}
+		names := make([]string, len(rel.TargetColumn))
+		for i, col := range rel.TargetColumn {
+			names[i] = col.Name
+		}
+		table := rel.TargetTable.FullName()
+		if key := table + "(" + strings.Join(names, ",") + ")"; !seen[key] {
+			seen[key] = true
+			keys[table] = append(keys[table], rel.TargetColumn)
+		}
+	}
+	return keys
+}
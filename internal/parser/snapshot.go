@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Discovered schema which can be stored in a file to skip discovery on repeat runs
+type SchemaSnapshot struct {
+	// Fingerprint of the catalog state and config the schema was discovered with
+	Fingerprint             string                    `json:"fingerprint"`
+	TablesWithPrimaryKey    []Table                   `json:"tables_with_primary_key"`
+	TablesWithoutPrimaryKey []Table                   `json:"tables_without_primary_key"`
+	Relationships           []Relationship            `json:"relationships"`
+	TableToPKColumnsMap     map[string][]Column       `json:"table_to_pk_columns_map"`
+	TableToUniqueKeysMap    map[string][][]string     `json:"table_to_unique_keys_map"`
+	TableToColumnLengthsMap map[string]map[string]int `json:"table_to_column_lengths_map"`
+}
+
+// Hash of every column, constraint and index definition in the configured schemas,
+// changes whenever a DDL statement touches something discovery depends on
+const catalogFingerprintQuery = `
+    SELECT
+        COALESCE(md5(string_agg(def, ',' ORDER BY def)), '')
+    FROM (
+        SELECT
+            format('a:%s.%s.%s.%s.%s.%s', n.nspname, c.relname, c.relkind, a.attname,
+                format_type(a.atttypid, a.atttypmod), a.attnotnull)
+        FROM
+            pg_class c
+            JOIN pg_namespace n ON n.oid = c.relnamespace
+            JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+        WHERE
+            c.relkind IN ('r', 'p')
+            AND n.nspname = ANY($1)
+        UNION ALL
+        SELECT
+            format('c:%s.%s.%s', n.nspname, c.relname, pg_get_constraintdef(con.oid))
+        FROM
+            pg_constraint con
+            JOIN pg_class c ON c.oid = con.conrelid
+            JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE
+            n.nspname = ANY($1)
+        UNION ALL
+        SELECT
+            format('i:%s.%s.%s', n.nspname, c.relname, pg_get_indexdef(i.indexrelid))
+        FROM
+            pg_index i
+            JOIN pg_class c ON c.oid = i.indrelid
+            JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE
+            i.indisunique
+            AND n.nspname = ANY($1)
+    ) defs(def)
+`
+
+// Compute the fingerprint of the current catalog state combined with the
+// config options that affect discovery
+func (p *Parser) schemaFingerprint(ctx context.Context) (string, error) {
+	var catalogHash string
+	if err := p.pool.QueryRow(ctx, catalogFingerprintQuery, p.config.Schemas).Scan(&catalogHash); err != nil {
+		return "", fmt.Errorf("failed to query catalog fingerprint: %w", err)
+	}
+
+	discoveryConfig, err := json.Marshal(struct {
+		Schemas        []string
+		IncludedTables []string
+		ExcludedTables []string
+	}{p.config.Schemas, p.config.IncludedTables, p.config.ExcludedTables})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(catalogHash))
+	hash.Write(discoveryConfig)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Snapshot returns the discovered schema together with the current catalog fingerprint
+func (p *Parser) Snapshot(ctx context.Context) (*SchemaSnapshot, error) {
+	fingerprint, err := p.schemaFingerprint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.snapshot(fingerprint), nil
+}
+
+func (p *Parser) snapshot(fingerprint string) *SchemaSnapshot {
+	// Virtual relationships are added from the config on every run
+	relationships := make([]Relationship, 0, len(p.Relationships))
+	for _, rel := range p.Relationships {
+		if !rel.Virtual {
+			relationships = append(relationships, rel)
+		}
+	}
+
+	return &SchemaSnapshot{
+		Fingerprint:             fingerprint,
+		TablesWithPrimaryKey:    p.TablesWithPrimaryKey,
+		TablesWithoutPrimaryKey: p.TablesWithoutPrimaryKey,
+		Relationships:           relationships,
+		TableToPKColumnsMap:     p.TableToPKColumnsMap,
+		TableToUniqueKeysMap:    p.TableToUniqueKeysMap,
+		TableToColumnLengthsMap: p.TableToColumnLengthsMap,
+	}
+}
+
+func (p *Parser) applySnapshot(snapshot *SchemaSnapshot) {
+	p.TablesWithPrimaryKey = snapshot.TablesWithPrimaryKey
+	p.TablesWithoutPrimaryKey = snapshot.TablesWithoutPrimaryKey
+	p.Relationships = snapshot.Relationships
+	p.TableToPKColumnsMap = snapshot.TableToPKColumnsMap
+	p.TableToUniqueKeysMap = snapshot.TableToUniqueKeysMap
+	p.TableToColumnLengthsMap = snapshot.TableToColumnLengthsMap
+}
+
+// LoadSchemaSnapshot reads a schema snapshot from a JSON file
+func LoadSchemaSnapshot(path string) (*SchemaSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot SchemaSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode schema snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// Save writes the schema snapshot to a JSON file
+func (s *SchemaSnapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema snapshot: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
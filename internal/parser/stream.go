@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Writes the records of a graph while it is traversed. Records are written in the order
+// they are discovered, which puts parents before their children except in dependency
+// cycles, where foreign keys to records not written yet are restored once the traversal ends.
+type graphStream struct {
+	p     *Parser
+	w     *bufio.Writer
+	json  *json.Encoder
+	set   *recordSet
+	masks map[string]MaskingRule
+	// Consecutive records of the same table waiting for a multi-row INSERT
+	batch []Record
+	// Foreign keys to records written after the record holding them
+	updates []DeferredUpdate
+	edges   []pendingEdge
+	written int
+}
+
+// Edge to a parent record which wasn't written yet when its child was
+type pendingEdge struct {
+	relationship Relationship
+	child        int
+	// Hash of the referenced key of the parent
+	parent recordHash
+}
+
+// StreamGraph writes the graph of the entry records to w while it is traversed instead of collecting
+// it first. Written records are only kept as hashes of their primary keys and referenced keys, but
+// memory still grows with the widest level of the traversal, whose records and parents are held
+// until they are written, and with the records at the depth limits, the foreign keys deferred to
+// the end and, for ndjson, the edges to parents not written yet. Only the sql and ndjson formats
+// can be streamed. Returns the number of written records.
+func (p *Parser) StreamGraph(ctx context.Context, w io.Writer, table Table, pks ...PrimaryKey) (int, error) {
+	defer p.Reset()
+
+	if p.config.Format != FormatSQL && p.config.Format != FormatNDJSON {
+		return 0, fmt.Errorf("%s output can't be streamed, use sql or ndjson", p.config.Format)
+	}
+	if p.config.KeyRemap != "" && p.config.KeyRemap != KeyRemapNone {
+		return 0, fmt.Errorf("key remapping needs the whole graph and can't be streamed")
+	}
+
+	s := &graphStream{p: p, w: bufio.NewWriter(w), masks: p.columnMasks()}
+	s.json = json.NewEncoder(s.w)
+	s.json.SetEscapeHTML(false)
+	s.set = newStreamingRecordSet(s.write, p.referencedKeys())
+
+	if err := p.buildGraph(ctx, table, pks, s.set); err != nil {
+		return 0, fmt.Errorf("failed to build graph: %w", err)
+	}
+	if err := s.close(ctx); err != nil {
+		return 0, err
+	}
+	return s.written, nil
+}
+
+// Write a record added to the set of the traversal
+func (s *graphStream) write(ctx context.Context, record Record, position int) error {
+	out := record
+	out.Values = append([]interface{}(nil), record.Values...)
+
+	for _, rel := range s.p.Relationships {
+		if rel.SourceTable.FullName() != record.Table.FullName() || !rel.appliesTo(record) ||
+			(!s.p.config.followsParents(rel) && !s.p.config.followsChildren(rel)) {
+			continue
+		}
+		fkValues, ok := record.valuesOf(rel.SourceColumn)
+		if !ok {
+			continue
+		}
+		parent := hashKey(rel.TargetTable, rel.TargetColumn, fkValues)
+		parentPosition, written := s.set.findHash(parent)
+
+		if s.p.config.Format == FormatNDJSON {
+			if written {
+				if err := s.writeEdge(Edge{Relationship: rel, Child: position, Parent: parentPosition}); err != nil {
+					return err
+				}
+			} else {
+				s.edges = append(s.edges, pendingEdge{relationship: rel, child: position, parent: parent})
+			}
+			continue
+		}
+
+		if written {
+			continue
+		}
+		// Insert the record without the reference and restore it once the parent may be written
+		if !isNullable(rel.SourceColumn) {
+			s.p.logger.Printf("unable to defer foreign key of table %s to a record not written yet, column is not nullable", record.Table.FullName())
+			continue
+		}
+		update := DeferredUpdate{Table: record.Table, Key: record.primaryKey(), Columns: rel.SourceColumn, Values: fkValues}
+		update.Values = s.p.maskValues(s.masks, update.Table, update.Columns, update.Values)
+		update.Key.Values = s.p.maskValues(s.masks, update.Table, update.Key.Columns, update.Key.Values)
+		s.updates = append(s.updates, update)
+		for _, col := range rel.SourceColumn {
+			out.Values[columnIndex(out.Columns, col.Name)] = nil
+		}
+	}
+
+	out.Values = s.p.maskValues(s.masks, out.Table, out.Columns, out.Values)
+	s.written++
+
+	if s.p.config.Format == FormatNDJSON {
+		line := s.p.jsonRecord(out)
+		line.Kind = "record"
+		if err := s.json.Encode(line); err != nil {
+			return fmt.Errorf("failed to encode record of %s: %w", out.Table.FullName(), err)
+		}
+		return nil
+	}
+
+	if len(s.batch) > 0 && (s.batch[0].Table.FullName() != out.Table.FullName() || len(s.batch) >= s.p.config.BatchSize) {
+		if err := s.flush(ctx); err != nil {
+			return err
+		}
+	}
+	s.batch = append(s.batch, out)
+	return nil
+}
+
+func (s *graphStream) writeEdge(edge Edge) error {
+	line := newJSONEdge(edge)
+	line.Kind = "edge"
+	if err := s.json.Encode(line); err != nil {
+		return fmt.Errorf("failed to encode edge %s: %w", edge.Relationship.Name, err)
+	}
+	return nil
+}
+
+// Write the pending INSERT
+func (s *graphStream) flush(ctx context.Context) error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	sql, err := s.p.GenerateInsertStatements(ctx, s.batch)
+	if err != nil {
+		return fmt.Errorf("failed to generate insert statements: %w", err)
+	}
+	s.batch = s.batch[:0]
+	_, err = s.w.WriteString(sql)
+	return err
+}
+
+// Write what could only be written once the traversal ended and flush the output
+func (s *graphStream) close(ctx context.Context) error {
+	if s.p.config.Format == FormatNDJSON {
+		for _, edge := range s.edges {
+			if parent, ok := s.set.findHash(edge.parent); ok {
+				if err := s.writeEdge(Edge{Relationship: edge.relationship, Child: edge.child, Parent: parent}); err != nil {
+					return err
+				}
+			}
+		}
+		for _, t := range s.p.Truncations {
+			line := s.p.jsonTruncation(t)
+			line.Kind = "truncation"
+			if err := s.json.Encode(line); err != nil {
+				return fmt.Errorf("failed to encode truncation of %s: %w", t.Relationship.SourceTable.FullName(), err)
+			}
+		}
+		return s.w.Flush()
+	}
+
+	if err := s.flush(ctx); err != nil {
+		return err
+	}
+	updateSQL, err := s.p.GenerateUpdateStatements(ctx, s.updates)
+	if err != nil {
+		return fmt.Errorf("failed to generate update statements: %w", err)
+	}
+	// Truncations are only known once the traversal ended
+	if _, err := s.w.WriteString(updateSQL + truncationComments(s.p.Truncations)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
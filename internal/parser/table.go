@@ -9,9 +9,10 @@ import (
 
 // Represents a database column
 type Column struct {
-	Name      string
-	DataType  string
-	IsPrimary bool
+	Name       string
+	DataType   string
+	IsPrimary  bool
+	IsNullable bool
 }
 
 // Represents a database table
@@ -32,54 +33,14 @@ func (t Table) FullName() string {
 
 // Get columns for a table
 func (t Table) getColumns(ctx context.Context, pool *pgxpool.Pool) ([]Column, error) {
-	query := `
-        SELECT
-            column_name,
-            data_type,
-            (
-                SELECT
-                    count(*) > 0
-                FROM
-                    information_schema.table_constraints tc
-                    JOIN information_schema.key_column_usage kcu
-                        ON tc.constraint_name = kcu.constraint_name
-                        AND tc.table_schema = kcu.table_schema
-                        AND tc.table_name = kcu.table_name
-                WHERE
-                    tc.constraint_type = 'PRIMARY KEY'
-                    AND tc.table_schema = $1
-                    AND tc.table_name = $2
-                    AND kcu.column_name = c.column_name
-            ) as is_primary
-        FROM
-            information_schema.columns c
-        WHERE
-            table_schema = $1
-            AND table_name = $2
-        ORDER BY
-            ordinal_position
-    `
-
-	rows, err := pool.Query(ctx, query, t.Schema, t.Name)
+	tables, err := queryCatalogTables(ctx, pool, []string{t.Schema}, &t.Name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query columns: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	var columns []Column
-	for rows.Next() {
-		var col Column
-		if err := rows.Scan(&col.Name, &col.DataType, &col.IsPrimary); err != nil {
-			return nil, fmt.Errorf("failed to scan column row: %w", err)
-		}
-		columns = append(columns, col)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating column rows: %w", err)
+	if len(tables) == 0 {
+		return nil, nil
 	}
-
-	return columns, nil
+	return tables[0].table.Columns, nil
 }
 
 func (p *Parser) discoverTablePKColumn(table Table) ([]Column, error) {
@@ -97,51 +58,24 @@ func (p *Parser) discoverTablePKColumn(table Table) ([]Column, error) {
 	return pkColumns, nil
 }
 
-func (p *Parser) discoverTables(ctx context.Context) ([]Table, []Table, error) {
-	query := `
-        SELECT
-            table_schema,
-            table_name
-        FROM
-            information_schema.tables
-        WHERE
-            table_schema = ANY($1)
-            AND table_type = 'BASE TABLE'
-    `
-	rows, err := p.pool.Query(ctx, query, p.config.Schemas)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to query tables: %w", err)
-	}
-	defer rows.Close()
+func (p *Parser) discoverTables(cat *catalog) ([]Table, []Table) {
 	var tablesWithPrimaryKey []Table
 	var tablesWithoutPrimaryKey []Table
 
-	for rows.Next() {
-		var schema, name string
-		if err := rows.Scan(&schema, &name); err != nil {
-			return nil, nil, fmt.Errorf("failed to scan table row: %w", err)
-		}
+	for _, t := range cat.tables {
+		table := t.table
 		// Skip excluded tables
-		if contains(p.config.ExcludedTables, name) {
+		if contains(p.config.ExcludedTables, table.Name) {
 			continue
 		}
 		// Skip tables not in included list (if specified)
-		if len(p.config.IncludedTables) > 0 && !contains(p.config.IncludedTables, name) {
+		if len(p.config.IncludedTables) > 0 && !contains(p.config.IncludedTables, table.Name) {
 			continue
 		}
-		table := Table{
-			Schema: schema,
-			Name:   name,
-		}
-		columns, err := table.getColumns(ctx, p.pool)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get columns for table %s: %w", table.FullName(), err)
-		}
-		table.Columns = columns
 
 		// Check if the table has a primary key
 		hasPrimaryKey := false
-		for _, col := range columns {
+		for _, col := range table.Columns {
 			if col.IsPrimary {
 				hasPrimaryKey = true
 				break
@@ -156,11 +90,7 @@ func (p *Parser) discoverTables(ctx context.Context) ([]Table, []Table, error) {
 		}
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, nil, fmt.Errorf("error iterating table rows: %w", err)
-	}
-
-	return tablesWithPrimaryKey, tablesWithoutPrimaryKey, nil
+	return tablesWithPrimaryKey, tablesWithoutPrimaryKey
 }
 
 func (p *Parser) getTable(schema, name string) (Table, error) {
@@ -0,0 +1,293 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Relationship which is not declared as a foreign key constraint in the database,
+// tables are given as `table` or `schema.table`.
+//
+// A polymorphic relationship sets TypeColumn and Targets instead of the target table,
+// the value of the type column of a source record decides which table it references.
+type VirtualRelationship struct {
+	// Optional name, used by relationship rules like a constraint name
+	Name          string   `yaml:"name"`
+	SourceTable   string   `yaml:"source_table"`
+	SourceColumns []string `yaml:"source_columns"`
+	TargetTable   string   `yaml:"target_table"`
+	TargetColumns []string `yaml:"target_columns"`
+	// Column of the source table holding the type of the referenced record
+	TypeColumn string `yaml:"type_column"`
+	// Referenced tables of a polymorphic relationship by the value of the type column
+	Targets []PolymorphicTarget `yaml:"targets"`
+}
+
+// Table referenced by the source records of a polymorphic relationship with the given type
+type PolymorphicTarget struct {
+	Type  string `yaml:"type"`
+	Table string `yaml:"table"`
+	// Referenced columns, the primary key of the table when empty
+	Columns []string `yaml:"columns"`
+}
+
+// Check whether the relationship picks its target table by the type column
+func (v VirtualRelationship) IsPolymorphic() bool {
+	return v.TypeColumn != "" || len(v.Targets) > 0
+}
+
+// Validate checks that the relationship names both tables and pairs its columns
+func (v VirtualRelationship) Validate() error {
+	if len(v.SourceColumns) == 0 {
+		return fmt.Errorf("source_columns are required")
+	}
+	if v.IsPolymorphic() {
+		return v.validatePolymorphic()
+	}
+	if v.SourceTable == "" || v.TargetTable == "" {
+		return fmt.Errorf("source_table and target_table are required")
+	}
+	if len(v.SourceColumns) != len(v.TargetColumns) {
+		return fmt.Errorf("source_columns and target_columns must have the same length")
+	}
+	return nil
+}
+
+func (v VirtualRelationship) validatePolymorphic() error {
+	if v.SourceTable == "" || v.TypeColumn == "" {
+		return fmt.Errorf("source_table and type_column are required")
+	}
+	if v.TargetTable != "" || len(v.TargetColumns) > 0 {
+		return fmt.Errorf("polymorphic relationship takes targets instead of target_table and target_columns")
+	}
+	if len(v.Targets) == 0 {
+		return fmt.Errorf("targets are required")
+	}
+	types := make(map[string]bool)
+	for _, target := range v.Targets {
+		if target.Type == "" || target.Table == "" {
+			return fmt.Errorf("type and table of every target are required")
+		}
+		if types[target.Type] {
+			return fmt.Errorf("type %q has several targets", target.Type)
+		}
+		types[target.Type] = true
+		if len(target.Columns) > 0 && len(target.Columns) != len(v.SourceColumns) {
+			return fmt.Errorf("source_columns and columns of target %q must have the same length", target.Type)
+		}
+	}
+	return nil
+}
+
+// LoadVirtualRelationships reads a list of virtual relationships from a YAML or JSON file
+func LoadVirtualRelationships(file string) ([]VirtualRelationship, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var relationships []VirtualRelationship
+	if err := yaml.Unmarshal(data, &relationships); err != nil {
+		return nil, fmt.Errorf("failed to decode virtual relationships: %w", err)
+	}
+	for i, v := range relationships {
+		if err := v.Validate(); err != nil {
+			return nil, fmt.Errorf("virtual relationship %d: %w", i+1, err)
+		}
+	}
+	return relationships, nil
+}
+
+// Resolve virtual relationships of the config against the discovered tables and
+// add them to the relationships, they are traversed exactly like discovered ones
+func (p *Parser) addVirtualRelationships() error {
+	for _, v := range p.config.VirtualRelationships {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("virtual relationship %s -> %s: %w", v.SourceTable, v.TargetTable, err)
+		}
+		if v.IsPolymorphic() {
+			if err := p.addPolymorphicRelationships(v); err != nil {
+				return fmt.Errorf("polymorphic relationship %s.%s: %w", v.SourceTable, v.TypeColumn, err)
+			}
+			continue
+		}
+		if p.isTableFiltered(v.SourceTable) || p.isTableFiltered(v.TargetTable) {
+			continue
+		}
+
+		rel, err := p.resolveVirtualRelationship(v)
+		if err != nil {
+			return fmt.Errorf("virtual relationship %s -> %s: %w", v.SourceTable, v.TargetTable, err)
+		}
+		p.Relationships = append(p.Relationships, rel)
+	}
+	return nil
+}
+
+// Add a relationship per target of a polymorphic relationship, each of them
+// only applies to the source records holding the type of its target
+func (p *Parser) addPolymorphicRelationships(v VirtualRelationship) error {
+	if p.isTableFiltered(v.SourceTable) {
+		return nil
+	}
+	source, err := p.findTable(v.SourceTable)
+	if err != nil {
+		return err
+	}
+	typeColumn, err := pickColumns(source, []string{v.TypeColumn})
+	if err != nil {
+		return err
+	}
+
+	for _, target := range v.Targets {
+		if p.isTableFiltered(target.Table) {
+			continue
+		}
+		targetTable, err := p.findTable(target.Table)
+		if err != nil {
+			return err
+		}
+		targetColumns := target.Columns
+		if len(targetColumns) == 0 {
+			targetColumns = primaryKeyColumnNames(targetTable)
+			if len(targetColumns) != len(v.SourceColumns) {
+				return fmt.Errorf("primary key of table %s doesn't match source_columns, set columns of target %q", targetTable.FullName(), target.Type)
+			}
+		}
+
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("%s_%s_polymorphic", source.Name, v.TypeColumn)
+		}
+		rel, err := p.resolveVirtualRelationship(VirtualRelationship{
+			Name:          name,
+			SourceTable:   source.FullName(),
+			SourceColumns: v.SourceColumns,
+			TargetTable:   targetTable.FullName(),
+			TargetColumns: targetColumns,
+		})
+		if err != nil {
+			return err
+		}
+		rel.Discriminator = &Discriminator{Column: typeColumn[0], Value: target.Type}
+		p.Relationships = append(p.Relationships, rel)
+	}
+	return nil
+}
+
+func (p *Parser) resolveVirtualRelationship(v VirtualRelationship) (Relationship, error) {
+	source, err := p.findTable(v.SourceTable)
+	if err != nil {
+		return Relationship{}, err
+	}
+	target, err := p.findTable(v.TargetTable)
+	if err != nil {
+		return Relationship{}, err
+	}
+	sourceCols, err := pickColumns(source, v.SourceColumns)
+	if err != nil {
+		return Relationship{}, err
+	}
+	targetCols, err := pickColumns(target, v.TargetColumns)
+	if err != nil {
+		return Relationship{}, err
+	}
+
+	name := v.Name
+	if name == "" {
+		name = fmt.Sprintf("%s_%s_virtual", source.Name, strings.Join(v.SourceColumns, "_"))
+	}
+
+	// Without constraints to look at, only primary keys are known to be unique
+	relType := relationTypeOf(source.FullName() == target.FullName(),
+		isPrimaryKey(source, sourceCols), isPrimaryKey(target, targetCols))
+
+	return Relationship{
+		Name:         name,
+		SourceTable:  source,
+		SourceColumn: sourceCols,
+		TargetTable:  target,
+		TargetColumn: targetCols,
+		RelationType: relType,
+		Virtual:      true,
+	}, nil
+}
+
+// Check whether the table is left out by the included and excluded tables of the config
+func (p *Parser) isTableFiltered(name string) bool {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	if contains(p.config.ExcludedTables, name) {
+		return true
+	}
+	return len(p.config.IncludedTables) > 0 && !contains(p.config.IncludedTables, name)
+}
+
+// Find a discovered table by its name, a name without schema has to be unique across schemas
+func (p *Parser) findTable(name string) (Table, error) {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return p.getTable(schema, table)
+	}
+
+	var found []Table
+	for _, table := range append(append([]Table(nil), p.TablesWithPrimaryKey...), p.TablesWithoutPrimaryKey...) {
+		if table.Name == name {
+			found = append(found, table)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Table{}, fmt.Errorf("table %s not found", name)
+	case 1:
+		return found[0], nil
+	default:
+		return Table{}, fmt.Errorf("table %s exists in several schemas, qualify it with a schema", name)
+	}
+}
+
+// Get columns of the table with the given names, in the given order
+func pickColumns(table Table, names []string) ([]Column, error) {
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		found := false
+		for _, col := range table.Columns {
+			if col.Name == name {
+				columns[i] = col
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %s not found in table %s", name, table.FullName())
+		}
+	}
+	return columns, nil
+}
+
+// Get names of the primary key columns of the table
+func primaryKeyColumnNames(table Table) []string {
+	var pk []string
+	for _, col := range table.Columns {
+		if col.IsPrimary {
+			pk = append(pk, col.Name)
+		}
+	}
+	return pk
+}
+
+// Check whether the columns are exactly the primary key of the table
+func isPrimaryKey(table Table, columns []Column) bool {
+	pk := primaryKeyColumnNames(table)
+	if len(pk) == 0 || len(pk) != len(columns) {
+		return false
+	}
+	for _, col := range columns {
+		if !contains(pk, col.Name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func TestVirtualRelationships(t *testing.T) {
+	t.Run("should load virtual relationships from a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "relationships.yaml")
+		err := os.WriteFile(path, []byte(`
+- name: fk_comments_post
+  source_table: comments
+  source_columns: [post_id]
+  target_table: public.posts
+  target_columns: [id]
+`), 0o644)
+		assert.NoError(t, err)
+
+		relationships, err := parser.LoadVirtualRelationships(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []parser.VirtualRelationship{{
+				Name:          "fk_comments_post",
+				SourceTable:   "comments",
+				SourceColumns: []string{"post_id"},
+				TargetTable:   "public.posts",
+				TargetColumns: []string{"id"},
+			}}, relationships)
+		}
+	})
+
+	t.Run("should validate virtual relationships", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			relationship parser.VirtualRelationship
+			expectError  bool
+		}{
+			{
+				name:         "Valid",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"post_id"}, TargetTable: "posts", TargetColumns: []string{"id"}},
+			},
+			{
+				name:         "Missing target table",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"post_id"}, TargetColumns: []string{"id"}},
+				expectError:  true,
+			},
+			{
+				name:         "Missing columns",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", TargetTable: "posts"},
+				expectError:  true,
+			},
+			{
+				name: "Polymorphic",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"commentable_id"}, TypeColumn: "commentable_type",
+					Targets: []parser.PolymorphicTarget{{Type: "Post", Table: "posts"}, {Type: "Photo", Table: "photos", Columns: []string{"id"}}}},
+			},
+			{
+				name:         "Polymorphic without targets",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"commentable_id"}, TypeColumn: "commentable_type"},
+				expectError:  true,
+			},
+			{
+				name: "Polymorphic with target table",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"commentable_id"}, TypeColumn: "commentable_type",
+					TargetTable: "posts", Targets: []parser.PolymorphicTarget{{Type: "Post", Table: "posts"}}},
+				expectError: true,
+			},
+			{
+				name: "Polymorphic with duplicate type",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"commentable_id"}, TypeColumn: "commentable_type",
+					Targets: []parser.PolymorphicTarget{{Type: "Post", Table: "posts"}, {Type: "Post", Table: "articles"}}},
+				expectError: true,
+			},
+			{
+				name:         "Unpaired columns",
+				relationship: parser.VirtualRelationship{SourceTable: "comments", SourceColumns: []string{"tenant_id", "post_id"}, TargetTable: "posts", TargetColumns: []string{"id"}},
+				expectError:  true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				err := tc.relationship.Validate()
+				if tc.expectError {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,22 @@
+CREATE TABLE tenants (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+
+-- Orders are numbered per tenant
+CREATE TABLE orders (
+    tenant_id INTEGER NOT NULL REFERENCES tenants (id),
+    id INTEGER NOT NULL,
+    reference VARCHAR(50) NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+-- Lines reference orders by the full composite key
+CREATE TABLE order_lines (
+    line_id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    order_id INTEGER NOT NULL,
+    product VARCHAR(100) NOT NULL,
+    CONSTRAINT fk_line_order FOREIGN KEY (tenant_id, order_id)
+        REFERENCES orders (tenant_id, id)
+);
@@ -0,0 +1,14 @@
+INSERT INTO tenants (id, name) VALUES
+(1, 'Acme'),
+(2, 'Globex');
+
+INSERT INTO orders (tenant_id, id, reference) VALUES
+(1, 1, 'ACME-1'),
+(1, 2, 'ACME-2'),
+(2, 1, 'GLOBEX-1');
+
+-- Order id 1 exists for both tenants, only the first line belongs to Acme
+INSERT INTO order_lines (line_id, tenant_id, order_id, product) VALUES
+(1, 1, 1, 'Widget'),
+(2, 2, 1, 'Gadget'),
+(3, 1, 2, 'Sprocket');
@@ -0,0 +1,11 @@
+CREATE TABLE posts (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL
+);
+
+-- post_id references posts without a foreign key constraint
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL,
+    body TEXT NOT NULL
+);
\ No newline at end of file
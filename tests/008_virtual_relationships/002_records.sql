@@ -0,0 +1,8 @@
+INSERT INTO posts (id, title) VALUES
+(1, 'First post'),
+(2, 'Second post');
+
+INSERT INTO comments (id, post_id, body) VALUES
+(1, 1, 'Nice'),
+(2, 1, 'Agreed'),
+(3, 2, 'Hello');
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE posts (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE photos (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL
+);
+
+-- commentable_type decides whether commentable_id references posts or photos
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    commentable_type VARCHAR(50) NOT NULL,
+    commentable_id INT NOT NULL,
+    body TEXT NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,12 @@
+INSERT INTO posts (id, title) VALUES
+(1, 'First post'),
+(2, 'Second post');
+
+INSERT INTO photos (id, url) VALUES
+(1, 'https://example.com/1.jpg');
+
+INSERT INTO comments (id, commentable_type, commentable_id, body) VALUES
+(1, 'Post', 1, 'Nice post'),
+(2, 'Photo', 1, 'Nice photo'),
+(3, 'Post', 2, 'Hello'),
+(4, 'Post', 1, 'Agreed');
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE customers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE events (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customers(id),
+    kind VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
\ No newline at end of file
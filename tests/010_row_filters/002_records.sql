@@ -0,0 +1,10 @@
+INSERT INTO customers (id, name) VALUES
+(1, 'Busy customer'),
+(2, 'Quiet customer');
+
+INSERT INTO events (id, customer_id, kind, created_at) VALUES
+(1, 1, 'click', '2024-01-01 10:00:00'),
+(2, 1, 'debug', '2024-01-02 10:00:00'),
+(3, 1, 'click', '2024-01-03 10:00:00'),
+(4, 1, 'view', '2024-01-04 10:00:00'),
+(5, 2, 'click', '2024-01-05 10:00:00');
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255)
+);
+
+CREATE TABLE orders (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Values which are escaped or formatted differently in COPY text format
+CREATE TABLE events (
+    payload JSONB,
+    data BYTEA,
+    starts_at TIME,
+    created_at TIMESTAMPTZ
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE documents (
+    id UUID PRIMARY KEY,
+    title VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE revisions (
+    id UUID PRIMARY KEY,
+    document_id UUID NOT NULL REFERENCES documents (id),
+    body TEXT NOT NULL
+);
\ No newline at end of file
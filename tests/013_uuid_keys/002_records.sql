@@ -0,0 +1,6 @@
+INSERT INTO documents (id, title) VALUES
+('00000000-0000-0000-0000-000000000001', 'Handbook');
+
+INSERT INTO revisions (id, document_id, body) VALUES
+('00000000-0000-0000-0000-000000000011', '00000000-0000-0000-0000-000000000001', 'Draft'),
+('00000000-0000-0000-0000-000000000012', '00000000-0000-0000-0000-000000000001', 'Final');
\ No newline at end of file
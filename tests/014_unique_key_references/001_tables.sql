@@ -0,0 +1,15 @@
+CREATE TABLE accounts (
+    id INTEGER PRIMARY KEY,
+    code VARCHAR(20) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    main_invoice_number VARCHAR(20)
+);
+
+CREATE TABLE invoices (
+    id INTEGER PRIMARY KEY,
+    number VARCHAR(20) NOT NULL UNIQUE,
+    account_code VARCHAR(20) NOT NULL REFERENCES accounts (code),
+    amount INTEGER NOT NULL
+);
+
+ALTER TABLE accounts ADD FOREIGN KEY (main_invoice_number) REFERENCES invoices (number);
\ No newline at end of file
@@ -0,0 +1,8 @@
+INSERT INTO accounts (id, code, name) VALUES
+(1, 'ACME', 'Acme');
+
+INSERT INTO invoices (id, number, account_code, amount) VALUES
+(1, 'INV-1', 'ACME', 100),
+(2, 'INV-2', 'ACME', 250);
+
+UPDATE accounts SET main_invoice_number = 'INV-1' WHERE id = 1;
\ No newline at end of file
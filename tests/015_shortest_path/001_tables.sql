@@ -0,0 +1,31 @@
+CREATE TABLE plans (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE districts (
+    id INTEGER PRIMARY KEY,
+    plan_id INTEGER NOT NULL REFERENCES plans (id)
+);
+
+CREATE TABLE regions (
+    id INTEGER PRIMARY KEY,
+    district_id INTEGER NOT NULL REFERENCES districts (id)
+);
+
+CREATE TABLE offices (
+    id INTEGER PRIMARY KEY,
+    region_id INTEGER NOT NULL REFERENCES regions (id)
+);
+
+CREATE TABLE employees (
+    id INTEGER PRIMARY KEY,
+    office_id INTEGER NOT NULL REFERENCES offices (id)
+);
+
+-- Reaches the district of the employee in two hops rather than the three through the office
+CREATE TABLE badges (
+    id INTEGER PRIMARY KEY,
+    employee_id INTEGER NOT NULL REFERENCES employees (id),
+    district_id INTEGER NOT NULL REFERENCES districts (id)
+);
\ No newline at end of file
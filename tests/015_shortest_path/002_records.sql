@@ -0,0 +1,6 @@
+INSERT INTO plans (id, name) VALUES (1, 'Standard');
+INSERT INTO districts (id, plan_id) VALUES (1, 1);
+INSERT INTO regions (id, district_id) VALUES (1, 1);
+INSERT INTO offices (id, region_id) VALUES (1, 1);
+INSERT INTO employees (id, office_id) VALUES (1, 1);
+INSERT INTO badges (id, employee_id, district_id) VALUES (1, 1, 1);
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE tenants (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE members (
+    tenant_id INTEGER NOT NULL REFERENCES tenants (id),
+    id INTEGER NOT NULL,
+    login VARCHAR(16) NOT NULL,
+    nickname VARCHAR(64),
+    PRIMARY KEY (tenant_id, id)
+);
+
+-- References an integer key from a bigint column
+CREATE TABLE invitations (
+    id INTEGER PRIMARY KEY,
+    tenant_id BIGINT NOT NULL REFERENCES tenants (id),
+    note VARCHAR(255)
+);
\ No newline at end of file
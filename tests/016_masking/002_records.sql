@@ -0,0 +1,3 @@
+INSERT INTO tenants (id, name) VALUES (1, 'Acme');
+INSERT INTO members (tenant_id, id, login, nickname) VALUES (1, 1, 'jdoe', 'JD');
+INSERT INTO invitations (id, tenant_id, note) VALUES (1, 1, 'welcome');
\ No newline at end of file
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
+)
+
+func BenchmarkBuildGraph(b *testing.B) {
+	ctx := context.Background()
+	_, pgPool := NewPostgresContainer(ctx, b, "011_synthetic_graph/001_tables.sql")
+
+	// Every skipped visit is logged, which would dominate the timings
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// A customer with the given number of orders, every order has three items
+	// referencing one of a hundred products
+	for _, orders := range []int{250, 1000, 5000} {
+		seed := fmt.Sprintf(`
+			TRUNCATE order_items, orders, products, customers RESTART IDENTITY;
+			INSERT INTO customers (name) VALUES ('customer');
+			INSERT INTO products (name) SELECT 'product ' || i FROM generate_series(1, 100) AS i;
+			INSERT INTO orders (customer_id) SELECT 1 FROM generate_series(1, %d);
+			INSERT INTO order_items (order_id, product_id) SELECT o.id, (o.id * 3 + k) %% 100 + 1 FROM orders AS o, generate_series(1, 3) AS k;`,
+			orders)
+		if _, err := pgPool.Exec(ctx, seed); err != nil {
+			b.Fatalf("failed to seed synthetic graph: %v", err)
+		}
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig())
+		if err != nil {
+			b.Fatalf("failed to create parser: %v", err)
+		}
+		table := parser.Table{Name: "customers", Schema: "public"}
+		pk, err := parser.NewPrimaryKey([]parser.Column{{Name: "id"}}, []interface{}{1})
+		if err != nil {
+			b.Fatalf("failed to create primary key: %v", err)
+		}
+
+		records := 1 + orders*4 + 100
+		b.Run(fmt.Sprintf("%d records", records), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				graph, err := p.BuildGraph(ctx, table, pk)
+				if err != nil {
+					b.Fatalf("failed to build graph: %v", err)
+				}
+				if len(graph) != records {
+					b.Fatalf("expected %d records, got %d", records, len(graph))
+				}
+				p.Reset()
+			}
+			b.ReportMetric(float64(records), "records/op")
+		})
+	}
+}
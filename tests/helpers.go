@@ -2,6 +2,8 @@ package tests
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,9 +11,11 @@ import (
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/desprit-media/traversql-core/internal/parser"
 )
 
-func NewPostgresContainer(ctx context.Context, t *testing.T, initFilePath ...string) (testcontainers.Container, *pgxpool.Pool) {
+func NewPostgresContainer(ctx context.Context, t testing.TB, initFilePath ...string) (testcontainers.Container, *pgxpool.Pool) {
 	pgContainer, err := postgres.Run(ctx,
 		"postgres:16",
 		postgres.WithUsername("test"),
@@ -53,6 +57,38 @@ func NewPostgresContainer(ctx context.Context, t *testing.T, initFilePath ...str
 	return pgContainer, pgPool
 }
 
+// IntPrimaryKey returns the primary key of a record with an integer id column
+func IntPrimaryKey(id int) parser.PrimaryKey {
+	return parser.PrimaryKey{
+		Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+		Values:  []interface{}{id},
+	}
+}
+
+// DescribeRecords returns the table name and first value of every record, e.g. users:1
+func DescribeRecords(records []parser.Record) []string {
+	var out []string
+	for _, record := range records {
+		out = append(out, fmt.Sprintf("%s:%v", record.Table.Name, record.Values[0]))
+	}
+	return out
+}
+
+// DescribeGraph builds the graph of the entry records with a parser of the given options
+// and describes its records, see DescribeRecords
+func DescribeGraph(ctx context.Context, t testing.TB, pgPool *pgxpool.Pool, table parser.Table, pks []parser.PrimaryKey, opts ...parser.ConfigOpt) []string {
+	t.Helper()
+	p, err := parser.NewParser(pgPool, parser.NewParserConfig(opts...))
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+	records, err := p.BuildGraph(ctx, table, pks...)
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+	return DescribeRecords(records)
+}
+
 func ExecuteOnTmpSchema(ctx context.Context, pgPool *pgxpool.Pool, tablesStmp string, sql string) error {
 	_, err := pgPool.Exec(ctx, "CREATE SCHEMA tmp_schema")
 	if err != nil {
@@ -73,3 +109,28 @@ func ExecuteOnTmpSchema(ctx context.Context, pgPool *pgxpool.Pool, tablesStmp st
 	_, err = pgPool.Exec(ctx, insertRecordsStmt)
 	return err
 }
+
+// LoadCopyStatements loads COPY ... FROM stdin blocks as written by the copy output format
+func LoadCopyStatements(ctx context.Context, pgPool *pgxpool.Pool, sql string) error {
+	conn, err := pgPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	lines := strings.Split(sql, "\n")
+	for i := 0; i < len(lines); i++ {
+		if lines[i] == "" {
+			continue
+		}
+		stmt := strings.TrimSuffix(lines[i], ";")
+		var data strings.Builder
+		for i++; i < len(lines) && lines[i] != `\.`; i++ {
+			data.WriteString(lines[i] + "\n")
+		}
+		if _, err := conn.Conn().PgConn().CopyFrom(ctx, strings.NewReader(data.String()), stmt); err != nil {
+			return fmt.Errorf("failed to run %s: %w", stmt, err)
+		}
+	}
+	return nil
+}
@@ -2,12 +2,15 @@ package tests
 
 import (
 	"context"
+	"fmt"
 	"math/big"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/desprit-media/traversql-core/internal/parser"
@@ -28,9 +31,9 @@ func TestParser(t *testing.T) {
 				mocks:   []string{"001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql"},
 				schemas: []string{"public"},
 				expected: []string{
-					"{users public [{Name:id DataType:integer IsPrimary:true} {Name:name DataType:character varying IsPrimary:false}]}",
-					"{orders public [{Name:id DataType:integer IsPrimary:true} {Name:user_id DataType:integer IsPrimary:false} {Name:amount DataType:numeric IsPrimary:false}]}",
-					"{payments public [{Name:id DataType:integer IsPrimary:true} {Name:order_id DataType:integer IsPrimary:false} {Name:amount DataType:numeric IsPrimary:false}]}",
+					"{users public [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:name DataType:character varying IsPrimary:false IsNullable:false}]}",
+					"{orders public [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:user_id DataType:integer IsPrimary:false IsNullable:false} {Name:amount DataType:numeric IsPrimary:false IsNullable:false}]}",
+					"{payments public [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:order_id DataType:integer IsPrimary:false IsNullable:false} {Name:amount DataType:numeric IsPrimary:false IsNullable:false}]}",
 				},
 			},
 			{
@@ -38,11 +41,11 @@ func TestParser(t *testing.T) {
 				mocks:   []string{"002_many_to_many/001_tables.sql", "002_many_to_many/002_records.sql"},
 				schemas: []string{"public"},
 				expected: []string{
-					"{users public [{Name:id DataType:integer IsPrimary:true} {Name:name DataType:character varying IsPrimary:false}]}",
-					"{user_orders public [{Name:user_id DataType:integer IsPrimary:true} {Name:order_id DataType:integer IsPrimary:true}]}",
-					"{orders public [{Name:id DataType:integer IsPrimary:true} {Name:amount DataType:numeric IsPrimary:false}]}",
-					"{order_payments public [{Name:order_id DataType:integer IsPrimary:true} {Name:payment_id DataType:integer IsPrimary:true}]}",
-					"{payments public [{Name:payment_id DataType:integer IsPrimary:true} {Name:amount DataType:numeric IsPrimary:false}]}",
+					"{users public [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:name DataType:character varying IsPrimary:false IsNullable:false}]}",
+					"{user_orders public [{Name:user_id DataType:integer IsPrimary:true IsNullable:false} {Name:order_id DataType:integer IsPrimary:true IsNullable:false}]}",
+					"{orders public [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:amount DataType:numeric IsPrimary:false IsNullable:false}]}",
+					"{order_payments public [{Name:order_id DataType:integer IsPrimary:true IsNullable:false} {Name:payment_id DataType:integer IsPrimary:true IsNullable:false}]}",
+					"{payments public [{Name:payment_id DataType:integer IsPrimary:true IsNullable:false} {Name:amount DataType:numeric IsPrimary:false IsNullable:false}]}",
 				},
 			},
 			{
@@ -50,8 +53,8 @@ func TestParser(t *testing.T) {
 				mocks:   []string{"005_self_referencing/001_tables.sql", "005_self_referencing/002_records.sql"},
 				schemas: []string{"public"},
 				expected: []string{
-					"{persons public [{Name:person_id DataType:integer IsPrimary:true} {Name:first_name DataType:character varying IsPrimary:false} {Name:gender_id DataType:integer IsPrimary:false} {Name:parent_id DataType:integer IsPrimary:false}]}",
-					"{genders public [{Name:gender_id DataType:integer IsPrimary:true} {Name:gender_name DataType:character varying IsPrimary:false}]}",
+					"{persons public [{Name:person_id DataType:integer IsPrimary:true IsNullable:false} {Name:first_name DataType:character varying IsPrimary:false IsNullable:false} {Name:gender_id DataType:integer IsPrimary:false IsNullable:false} {Name:parent_id DataType:integer IsPrimary:false IsNullable:true}]}",
+					"{genders public [{Name:gender_id DataType:integer IsPrimary:true IsNullable:false} {Name:gender_name DataType:character varying IsPrimary:false IsNullable:false}]}",
 				},
 			},
 		}
@@ -77,26 +80,34 @@ func TestParser(t *testing.T) {
 				name:  "one-to-one",
 				mocks: []string{"001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql"},
 				expected: []string{
-					"many-to-one | public.orders.[{Name:user_id DataType:integer IsPrimary:false}] -> public.users.[{Name:id DataType:integer IsPrimary:true}]",
-					"many-to-one | public.payments.[{Name:order_id DataType:integer IsPrimary:false}] -> public.orders.[{Name:id DataType:integer IsPrimary:true}]",
+					"many-to-one | public.orders.[{Name:user_id DataType:integer IsPrimary:false IsNullable:false}] -> public.users.[{Name:id DataType:integer IsPrimary:true IsNullable:false}]",
+					"many-to-one | public.payments.[{Name:order_id DataType:integer IsPrimary:false IsNullable:false}] -> public.orders.[{Name:id DataType:integer IsPrimary:true IsNullable:false}]",
 				},
 			},
 			{
 				name:  "many-to-many",
 				mocks: []string{"002_many_to_many/001_tables.sql", "002_many_to_many/002_records.sql"},
 				expected: []string{
-					"one-to-one | public.user_orders.[{Name:user_id DataType:integer IsPrimary:true}] -> public.users.[{Name:id DataType:integer IsPrimary:true}]",
-					"one-to-one | public.user_orders.[{Name:order_id DataType:integer IsPrimary:true}] -> public.orders.[{Name:id DataType:integer IsPrimary:true}]",
-					"one-to-one | public.order_payments.[{Name:order_id DataType:integer IsPrimary:true}] -> public.orders.[{Name:id DataType:integer IsPrimary:true}]",
-					"one-to-one | public.order_payments.[{Name:payment_id DataType:integer IsPrimary:true}] -> public.payments.[{Name:payment_id DataType:integer IsPrimary:true}]",
+					"one-to-one | public.user_orders.[{Name:user_id DataType:integer IsPrimary:true IsNullable:false}] -> public.users.[{Name:id DataType:integer IsPrimary:true IsNullable:false}]",
+					"one-to-one | public.user_orders.[{Name:order_id DataType:integer IsPrimary:true IsNullable:false}] -> public.orders.[{Name:id DataType:integer IsPrimary:true IsNullable:false}]",
+					"one-to-one | public.order_payments.[{Name:order_id DataType:integer IsPrimary:true IsNullable:false}] -> public.orders.[{Name:id DataType:integer IsPrimary:true IsNullable:false}]",
+					"one-to-one | public.order_payments.[{Name:payment_id DataType:integer IsPrimary:true IsNullable:false}] -> public.payments.[{Name:payment_id DataType:integer IsPrimary:true IsNullable:false}]",
 				},
 			},
 			{
 				name:  "self-referencing",
 				mocks: []string{"005_self_referencing/001_tables.sql", "005_self_referencing/002_records.sql"},
 				expected: []string{
-					"many-to-one | public.persons.[{Name:gender_id DataType:integer IsPrimary:false}] -> public.genders.[{Name:gender_id DataType:integer IsPrimary:true}]",
-					"self-referencing | public.persons.[{Name:parent_id DataType:integer IsPrimary:false}] -> public.persons.[{Name:person_id DataType:integer IsPrimary:true}]",
+					"many-to-one | public.persons.[{Name:gender_id DataType:integer IsPrimary:false IsNullable:false}] -> public.genders.[{Name:gender_id DataType:integer IsPrimary:true IsNullable:false}]",
+					"self-referencing | public.persons.[{Name:parent_id DataType:integer IsPrimary:false IsNullable:true}] -> public.persons.[{Name:person_id DataType:integer IsPrimary:true IsNullable:false}]",
+				},
+			},
+			{
+				name:  "composite keys",
+				mocks: []string{"007_composite_keys/001_tables.sql", "007_composite_keys/002_records.sql"},
+				expected: []string{
+					"one-to-one | public.orders.[{Name:tenant_id DataType:integer IsPrimary:true IsNullable:false}] -> public.tenants.[{Name:id DataType:integer IsPrimary:true IsNullable:false}]",
+					"many-to-one | public.order_lines.[{Name:tenant_id DataType:integer IsPrimary:false IsNullable:false} {Name:order_id DataType:integer IsPrimary:false IsNullable:false}] -> public.orders.[{Name:tenant_id DataType:integer IsPrimary:true IsNullable:false} {Name:id DataType:integer IsPrimary:true IsNullable:false}]",
 				},
 			},
 		}
@@ -165,6 +176,47 @@ func TestParser(t *testing.T) {
 		}
 	})
 
+	t.Run("should reuse schema cache until the schema changes", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+		cachePath := filepath.Join(t.TempDir(), "schema.json")
+
+		// First run discovers the schema and stores it
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithSchemaCache(cachePath)))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		snapshot, err := parser.LoadSchemaSnapshot(cachePath)
+		if assert.NoError(t, err, "schema cache should have been written") {
+			assert.Equal(t, p.Relationships, snapshot.Relationships)
+			assert.Equal(t, p.TableToPKColumnsMap, snapshot.TableToPKColumnsMap)
+		}
+
+		// Second run loads the same schema from the cache
+		cached, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithSchemaCache(cachePath)))
+		if assert.NoError(t, err, "failed to create parser from cache") {
+			assert.Equal(t, p.TablesWithPrimaryKey, cached.TablesWithPrimaryKey)
+			assert.Equal(t, p.Relationships, cached.Relationships)
+		}
+
+		// Changing the schema invalidates the cache
+		_, err = pgPool.Exec(ctx, "ALTER TABLE payments ADD COLUMN note TEXT")
+		if !assert.NoError(t, err) {
+			return
+		}
+		refreshed, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithSchemaCache(cachePath)))
+		if assert.NoError(t, err, "failed to create parser after schema change") {
+			updated, err := parser.LoadSchemaSnapshot(cachePath)
+			if assert.NoError(t, err) {
+				assert.NotEqual(t, snapshot.Fingerprint, updated.Fingerprint)
+			}
+			for _, table := range refreshed.TablesWithPrimaryKey {
+				if table.Name == "payments" {
+					assert.Equal(t, "note", table.Columns[len(table.Columns)-1].Name)
+				}
+			}
+		}
+	})
+
 	t.Run("should fetch record", func(t *testing.T) {
 		cases := []struct {
 			name   string
@@ -189,7 +241,7 @@ func TestParser(t *testing.T) {
 							{Name: "name", DataType: "character varying", IsPrimary: false},
 						}},
 						pk:     parser.PrimaryKey{Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}}, Values: []interface{}{1}},
-						record: "{public.users [{Name:id DataType:integer IsPrimary:true} {Name:name DataType:character varying IsPrimary:false}] [1 John Doe]}",
+						record: "{public.users [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:name DataType:character varying IsPrimary:false IsNullable:false}] [1 John Doe]}",
 					},
 					{
 						table: parser.Table{Name: "orders", Schema: "public", Columns: []parser.Column{
@@ -198,7 +250,7 @@ func TestParser(t *testing.T) {
 							{Name: "amount", DataType: "numeric", IsPrimary: false},
 						}},
 						pk:     parser.PrimaryKey{Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}}, Values: []interface{}{1}},
-						record: "{public.orders [{Name:id DataType:integer IsPrimary:true} {Name:user_id DataType:integer IsPrimary:false} {Name:amount DataType:numeric IsPrimary:false}] [1 1 {Int:+9999 Exp:-2 NaN:false InfinityModifier:finite Valid:true}]}",
+						record: "{public.orders [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:user_id DataType:integer IsPrimary:false IsNullable:false} {Name:amount DataType:numeric IsPrimary:false IsNullable:false}] [1 1 {Int:+9999 Exp:-2 NaN:false InfinityModifier:finite Valid:true}]}",
 					},
 					{
 						table: parser.Table{Name: "payments", Schema: "public", Columns: []parser.Column{
@@ -207,7 +259,7 @@ func TestParser(t *testing.T) {
 							{Name: "amount", DataType: "numeric", IsPrimary: false},
 						}},
 						pk:     parser.PrimaryKey{Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}}, Values: []interface{}{1}},
-						record: "{public.payments [{Name:id DataType:integer IsPrimary:true} {Name:order_id DataType:integer IsPrimary:false} {Name:amount DataType:numeric IsPrimary:false}] [1 1 {Int:+9999 Exp:-2 NaN:false InfinityModifier:finite Valid:true}]}",
+						record: "{public.payments [{Name:id DataType:integer IsPrimary:true IsNullable:false} {Name:order_id DataType:integer IsPrimary:false IsNullable:false} {Name:amount DataType:numeric IsPrimary:false IsNullable:false}] [1 1 {Int:+9999 Exp:-2 NaN:false InfinityModifier:finite Valid:true}]}",
 					},
 				},
 			},
@@ -316,24 +368,24 @@ func TestParser(t *testing.T) {
 								Values:  []interface{}{int32(1), "John Doe"},
 							},
 							{
-								Table:   parser.Table{Name: "user_orders", Schema: "public"},
-								Columns: []parser.Column{{Name: "user_id"}, {Name: "order_id"}},
-								Values:  []interface{}{int32(1), int32(1)},
+								Table:   parser.Table{Name: "payments", Schema: "public"},
+								Columns: []parser.Column{{Name: "payment_id"}, {Name: "amount"}},
+								Values:  []interface{}{int32(1), pgtype.Numeric{Int: big.NewInt(5025), Exp: -2, Valid: true}},
 							},
 							{
 								Table:   parser.Table{Name: "payments", Schema: "public"},
 								Columns: []parser.Column{{Name: "payment_id"}, {Name: "amount"}},
-								Values:  []interface{}{int32(1), pgtype.Numeric{Int: big.NewInt(5025), Exp: -2, Valid: true}},
+								Values:  []interface{}{int32(2), pgtype.Numeric{Int: big.NewInt(5025), Exp: -2, Valid: true}},
 							},
 							{
-								Table:   parser.Table{Name: "order_payments", Schema: "public"},
-								Columns: []parser.Column{{Name: "order_id"}, {Name: "payment_id"}},
+								Table:   parser.Table{Name: "user_orders", Schema: "public"},
+								Columns: []parser.Column{{Name: "user_id"}, {Name: "order_id"}},
 								Values:  []interface{}{int32(1), int32(1)},
 							},
 							{
-								Table:   parser.Table{Name: "payments", Schema: "public"},
-								Columns: []parser.Column{{Name: "payment_id"}, {Name: "amount"}},
-								Values:  []interface{}{int32(2), pgtype.Numeric{Int: big.NewInt(5025), Exp: -2, Valid: true}},
+								Table:   parser.Table{Name: "order_payments", Schema: "public"},
+								Columns: []parser.Column{{Name: "order_id"}, {Name: "payment_id"}},
+								Values:  []interface{}{int32(1), int32(1)},
 							},
 							{
 								Table:   parser.Table{Name: "order_payments", Schema: "public"},
@@ -393,6 +445,51 @@ func TestParser(t *testing.T) {
 					},
 				},
 			},
+			{
+				name:    "composite keys",
+				mocks:   []string{"007_composite_keys/001_tables.sql", "007_composite_keys/002_records.sql"},
+				schemas: []string{"public"},
+				checks: []struct {
+					table   parser.Table
+					pk      parser.PrimaryKey
+					results []parser.Record
+				}{
+					{
+						// we search in this table
+						table: parser.Table{
+							Name:   "orders",
+							Schema: "public",
+						},
+						// we search for this primary key
+						pk: parser.PrimaryKey{
+							Columns: []parser.Column{
+								{Name: "tenant_id", DataType: "integer", IsPrimary: true},
+								{Name: "id", DataType: "integer", IsPrimary: true},
+							},
+							Values: []interface{}{1, 1},
+						},
+						// and we expected to get the following records,
+						// the line of the other tenant's order 1 must not be included
+						results: []parser.Record{
+							{
+								Table:   parser.Table{Name: "tenants", Schema: "public"},
+								Columns: []parser.Column{{Name: "id"}, {Name: "name"}},
+								Values:  []interface{}{int32(1), "Acme"},
+							},
+							{
+								Table:   parser.Table{Name: "orders", Schema: "public"},
+								Columns: []parser.Column{{Name: "tenant_id"}, {Name: "id"}, {Name: "reference"}},
+								Values:  []interface{}{int32(1), int32(1), "ACME-1"},
+							},
+							{
+								Table:   parser.Table{Name: "order_lines", Schema: "public"},
+								Columns: []parser.Column{{Name: "line_id"}, {Name: "tenant_id"}, {Name: "order_id"}, {Name: "product"}},
+								Values:  []interface{}{int32(1), int32(1), int32(1), "Widget"},
+							},
+						},
+					},
+				},
+			},
 		}
 
 		for _, c := range cases {
@@ -458,32 +555,41 @@ func TestParser(t *testing.T) {
 					},
 				},
 			},
-			// {
-			// 	name:        "circular dependencies with endless loop",
-			// 	tableMocks:  []string{"004_circular_loop/001_tables.sql"},
-			// 	recordMocks: []string{"004_circular_loop/002_records.sql"},
-			// 	schemas:     []string{"example"},
-			// 	checks: []struct {
-			// 		table parser.Table
-			// 		pk    parser.PrimaryKey
-			// 		sql   string
-			// 		error error
-			// 	}{
-			// 		{
-			// 			table: parser.Table{
-			// 				Name:   "departments",
-			// 				Schema: "example",
-			// 			},
-			// 			pk: parser.PrimaryKey{
-			// 				Columns: []parser.Column{
-			// 					{Name: "department_id", DataType: "integer", IsPrimary: true},
-			// 				},
-			// 				Values: []interface{}{5},
-			// 			},
-			// 			error: nil,
-			// 		},
-			// 	},
-			// },
+			{
+				name:        "circular dependencies with endless loop",
+				tableMocks:  []string{"004_circular_loop/001_tables.sql"},
+				recordMocks: []string{"004_circular_loop/002_records.sql"},
+				schemas:     []string{"example"},
+				checks: []struct {
+					table parser.Table
+					pk    parser.PrimaryKey
+					sql   string
+					error error
+				}{
+					{
+						table: parser.Table{
+							Name:   "departments",
+							Schema: "example",
+						},
+						pk: parser.PrimaryKey{
+							Columns: []parser.Column{
+								{Name: "department_id", DataType: "integer", IsPrimary: true},
+							},
+							Values: []interface{}{5},
+						},
+						// The cycle between the user and its department is broken at the first record
+						// with a nullable foreign key, which is restored once both are inserted
+						sql: "INSERT INTO example.users (user_id, username, department_id) VALUES (5, 'dlee', NULL);\n" +
+							"INSERT INTO example.departments (department_id, name, manager_id) VALUES (5, 'Research', 5);\n" +
+							"INSERT INTO example.projects (project_id, name, department_id, lead_id) VALUES (5, 'New Product Development', 5, 5);\n" +
+							"INSERT INTO example.tasks (task_id, name, project_id, parent_task_id) VALUES (10, 'Market research', 5, NULL);\n" +
+							"INSERT INTO example.tasks (task_id, name, project_id, parent_task_id) VALUES (11, 'Prototype design', 5, 10);\n" +
+							"INSERT INTO example.project_main_tasks (project_id, main_task_id) VALUES (5, 10);\n" +
+							"UPDATE example.users SET department_id = 5 WHERE user_id = 5 AND department_id IS NULL;\n",
+						error: nil,
+					},
+				},
+			},
 			{
 				name:        "deduplication",
 				tableMocks:  []string{"006_deduplication/001_tables.sql"},
@@ -579,9 +685,107 @@ func TestParser(t *testing.T) {
 		}
 	})
 
+	t.Run("should copy records graph", func(t *testing.T) {
+		_, targetPool := NewPostgresContainer(ctx, t, "003_circular_simple/001_tables.sql")
+		_, sourcePool := NewPostgresContainer(ctx, t, "003_circular_simple/001_tables.sql", "003_circular_simple/002_records.sql")
+
+		table := parser.Table{Name: "persons", Schema: "example"}
+		pk := parser.PrimaryKey{
+			Columns: []parser.Column{{Name: "person_id", DataType: "integer", IsPrimary: true}},
+			Values:  []interface{}{1},
+		}
+		countRecords := func() int {
+			var count int
+			err := targetPool.QueryRow(ctx, `
+				SELECT (SELECT COUNT(*) FROM example.countries)
+					+ (SELECT COUNT(*) FROM example.cars)
+					+ (SELECT COUNT(*) FROM example.persons)
+			`).Scan(&count)
+			assert.NoError(t, err)
+			return count
+		}
+
+		p, err := parser.NewParser(sourcePool, parser.NewParserConfig(parser.WithSchemas([]string{"example"})))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		copied, err := p.CopyGraph(ctx, targetPool, table, pk)
+		if assert.NoError(t, err, "failed to copy graph") {
+			assert.Equal(t, 3, copied)
+			assert.Equal(t, 3, countRecords())
+		}
+
+		// Copying again fails on the first duplicate and leaves the target untouched
+		_, err = p.CopyGraph(ctx, targetPool, table, pk)
+		assert.Error(t, err, "copying existing records should fail by default")
+		assert.Equal(t, 3, countRecords())
+
+		// Existing records are kept when skipping conflicts
+		p, err = parser.NewParser(sourcePool, parser.NewParserConfig(
+			parser.WithSchemas([]string{"example"}),
+			parser.WithConflictMode(parser.ConflictDoNothing),
+		))
+		if assert.NoError(t, err, "failed to create parser") {
+			_, err = p.CopyGraph(ctx, targetPool, table, pk)
+			assert.NoError(t, err, "copying existing records should be skipped")
+			assert.Equal(t, 3, countRecords())
+		}
+
+		// Existing records are overwritten when updating on conflict
+		_, err = targetPool.Exec(ctx, "UPDATE example.persons SET first_name = 'Changed' WHERE person_id = 1")
+		assert.NoError(t, err)
+		p, err = parser.NewParser(sourcePool, parser.NewParserConfig(
+			parser.WithSchemas([]string{"example"}),
+			parser.WithConflictMode(parser.ConflictDoUpdate),
+		))
+		if assert.NoError(t, err, "failed to create parser") {
+			_, err = p.CopyGraph(ctx, targetPool, table, pk)
+			if assert.NoError(t, err, "copying existing records should update them") {
+				var firstName string
+				err = targetPool.QueryRow(ctx, "SELECT first_name FROM example.persons WHERE person_id = 1").Scan(&firstName)
+				assert.NoError(t, err)
+				assert.Equal(t, "John", firstName)
+			}
+		}
+	})
+
+	t.Run("should copy data types unchanged", func(t *testing.T) {
+		_, targetPool := NewPostgresContainer(ctx, t, "100_data_types/001_tables.sql")
+		_, sourcePool := NewPostgresContainer(ctx, t, "100_data_types/001_tables.sql", "100_data_types/002_records.sql")
+
+		_, err := sourcePool.Exec(ctx, `
+			UPDATE cars SET maintenance_time = '08:30:00.123456', car_image = '\xdeadbeef',
+				features = '{"navigation": true, "trims": ["base", "sport"], "note": "it''s \"new\""}' WHERE id = 1;
+			UPDATE cars SET price = 12345678.91 WHERE id = 2`)
+		if !assert.NoError(t, err, "failed to update cars") {
+			return
+		}
+
+		p, err := parser.NewParser(sourcePool, parser.NewParserConfig())
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		copied, err := p.CopyGraph(ctx, targetPool, parser.Table{Name: "persons", Schema: "public"}, IntPrimaryKey(1), IntPrimaryKey(2))
+		if !assert.NoError(t, err, "failed to copy records graph") {
+			return
+		}
+		assert.Equal(t, 4, copied)
+
+		// JSON, numeric, bytea and time values arrive as they were read
+		query := "SELECT string_agg(concat_ws('|', id, features, price, encode(car_image, 'hex'), maintenance_time), ',' ORDER BY id) FROM cars"
+		var expected, actual string
+		if assert.NoError(t, sourcePool.QueryRow(ctx, query).Scan(&expected), "failed to query source cars") &&
+			assert.NoError(t, targetPool.QueryRow(ctx, query).Scan(&actual), "failed to query copied cars") {
+			assert.Equal(t, expected, actual)
+		}
+	})
+
 	t.Run("should generate insert statements", func(t *testing.T) {
-		_, pgPool := NewPostgresContainer(ctx, t)
-		p, _ := parser.NewParser(pgPool, parser.NewParserConfig())
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql")
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig())
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
 		// Create a fixed time for testing
 		testTime, _ := time.Parse(time.RFC3339, "2023-01-02T15:04:05Z")
 		// Create a pgtype.Numeric for testing
@@ -734,4 +938,1121 @@ func TestParser(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("should generate insert statements with conflict handling", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "002_many_to_many/001_tables.sql")
+
+		records := []parser.Record{
+			{
+				Table:   parser.Table{Name: "users", Schema: "public"},
+				Columns: []parser.Column{{Name: "id"}, {Name: "name"}},
+				Values:  []interface{}{1, "John"},
+			},
+			{
+				Table:   parser.Table{Name: "user_orders", Schema: "public"},
+				Columns: []parser.Column{{Name: "user_id"}, {Name: "order_id"}},
+				Values:  []interface{}{1, 2},
+			},
+		}
+
+		cases := []struct {
+			name        string
+			mode        parser.ConflictMode
+			expectedSQL string
+		}{
+			{
+				name: "none",
+				mode: parser.ConflictNone,
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (1, 'John');\n" +
+					"INSERT INTO public.user_orders (user_id, order_id) VALUES (1, 2);\n",
+			},
+			{
+				name: "do nothing",
+				mode: parser.ConflictDoNothing,
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (1, 'John') ON CONFLICT DO NOTHING;\n" +
+					"INSERT INTO public.user_orders (user_id, order_id) VALUES (1, 2) ON CONFLICT DO NOTHING;\n",
+			},
+			{
+				name: "do update",
+				mode: parser.ConflictDoUpdate,
+				// tables where every column is part of the primary key have nothing to update
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (1, 'John') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name;\n" +
+					"INSERT INTO public.user_orders (user_id, order_id) VALUES (1, 2) ON CONFLICT DO NOTHING;\n",
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithConflictMode(c.mode)))
+				if assert.NoError(t, err, "failed to create parser for case %s", c.name) {
+					sql, err := p.GenerateInsertStatements(ctx, records)
+					if assert.NoError(t, err, "error generating insert statements for case %s", c.name) {
+						assert.Equal(t, c.expectedSQL, sql, "SQL statements should be equal in case %s", c.name)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("should generate batched insert statements", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql")
+
+		user := func(id int, name string) parser.Record {
+			return parser.Record{
+				Table:   parser.Table{Name: "users", Schema: "public"},
+				Columns: []parser.Column{{Name: "id"}, {Name: "name"}},
+				Values:  []interface{}{id, name},
+			}
+		}
+		order := func(id int, userID int) parser.Record {
+			return parser.Record{
+				Table:   parser.Table{Name: "orders", Schema: "public"},
+				Columns: []parser.Column{{Name: "id"}, {Name: "user_id"}},
+				Values:  []interface{}{id, userID},
+			}
+		}
+		// order of records must be kept, so only consecutive records are grouped
+		records := []parser.Record{user(1, "John"), user(2, "Jane"), user(3, "Bob"), order(1, 1), user(4, "Alice")}
+
+		cases := []struct {
+			name        string
+			opts        []parser.ConfigOpt
+			expectedSQL string
+		}{
+			{
+				name: "batches of two",
+				opts: []parser.ConfigOpt{parser.WithBatchSize(2)},
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (1, 'John'), (2, 'Jane');\n" +
+					"INSERT INTO public.users (id, name) VALUES (3, 'Bob');\n" +
+					"INSERT INTO public.orders (id, user_id) VALUES (1, 1);\n" +
+					"INSERT INTO public.users (id, name) VALUES (4, 'Alice');\n",
+			},
+			{
+				name: "batches with conflict handling",
+				opts: []parser.ConfigOpt{parser.WithBatchSize(100), parser.WithConflictMode(parser.ConflictDoNothing)},
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (1, 'John'), (2, 'Jane'), (3, 'Bob') ON CONFLICT DO NOTHING;\n" +
+					"INSERT INTO public.orders (id, user_id) VALUES (1, 1) ON CONFLICT DO NOTHING;\n" +
+					"INSERT INTO public.users (id, name) VALUES (4, 'Alice') ON CONFLICT DO NOTHING;\n",
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(c.opts...))
+				if assert.NoError(t, err, "failed to create parser for case %s", c.name) {
+					sql, err := p.GenerateInsertStatements(ctx, records)
+					if assert.NoError(t, err, "error generating insert statements for case %s", c.name) {
+						assert.Equal(t, c.expectedSQL, sql, "SQL statements should be equal in case %s", c.name)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("should generate copy statements", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "012_copy_format/001_tables.sql")
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithFormat(parser.FormatCopy)))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		user := func(id int, name interface{}) parser.Record {
+			return parser.Record{
+				Table:   parser.Table{Name: "users", Schema: "public"},
+				Columns: []parser.Column{{Name: "id"}, {Name: "name"}},
+				Values:  []interface{}{id, name},
+			}
+		}
+		order := func(id int, userID int, amount interface{}) parser.Record {
+			return parser.Record{
+				Table:   parser.Table{Name: "orders", Schema: "public"},
+				Columns: []parser.Column{{Name: "id"}, {Name: "user_id"}, {Name: "amount"}},
+				Values:  []interface{}{id, userID, amount},
+			}
+		}
+		event := parser.Record{
+			Table:   parser.Table{Name: "events", Schema: "public"},
+			Columns: []parser.Column{{Name: "payload"}, {Name: "data"}, {Name: "starts_at"}, {Name: "created_at"}},
+			Values: []interface{}{
+				map[string]interface{}{"note": "a\tb"},
+				[]byte{0xde, 0xad},
+				pgtype.Time{Microseconds: 3723000000, Valid: true},
+				time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		}
+
+		// records of the same table are written in a single block, after the tables they reference
+		records := []parser.Record{
+			user(1, "tab\there\nand new line\\"),
+			order(1, 1, pgtype.Numeric{Int: big.NewInt(1050), Exp: -2, Valid: true}),
+			user(2, nil),
+			order(2, 2, pgtype.Numeric{Int: big.NewInt(3), Exp: 0, Valid: true}),
+			event,
+		}
+
+		expectedSQL := "COPY public.users (id, name) FROM stdin;\n" +
+			"1\ttab\\there\\nand new line\\\\\n" +
+			"2\t\\N\n" +
+			"\\.\n" +
+			"COPY public.orders (id, user_id, amount) FROM stdin;\n" +
+			"1\t1\t10.50\n" +
+			"2\t2\t3\n" +
+			"\\.\n" +
+			"COPY public.events (payload, data, starts_at, created_at) FROM stdin;\n" +
+			"{\"note\":\"a\\\\tb\"}\t\\\\xdead\t01:02:03\t2024-01-02T03:04:05Z\n" +
+			"\\.\n"
+
+		sql, err := p.GenerateCopyStatements(ctx, records)
+		if !assert.NoError(t, err, "error generating copy statements") {
+			return
+		}
+		assert.Equal(t, expectedSQL, sql, "COPY blocks should be equal")
+
+		// The blocks load back into the same values
+		if !assert.NoError(t, LoadCopyStatements(ctx, pgPool, sql), "failed to load copy statements") {
+			return
+		}
+		var name string
+		var nullName bool
+		var amounts string
+		err = pgPool.QueryRow(ctx, `SELECT
+			(SELECT name FROM users WHERE id = 1),
+			(SELECT name IS NULL FROM users WHERE id = 2),
+			(SELECT string_agg(amount::text, ',' ORDER BY id) FROM orders)`).Scan(&name, &nullName, &amounts)
+		if assert.NoError(t, err, "failed to query loaded users and orders") {
+			assert.Equal(t, "tab\there\nand new line\\", name)
+			assert.True(t, nullName)
+			assert.Equal(t, "10.50,3.00", amounts)
+		}
+		var note, startsAt string
+		var data []byte
+		var createdAt time.Time
+		err = pgPool.QueryRow(ctx, "SELECT payload->>'note', data, starts_at::text, created_at FROM events").Scan(&note, &data, &startsAt, &createdAt)
+		if assert.NoError(t, err, "failed to query loaded events") {
+			assert.Equal(t, "a\tb", note)
+			assert.Equal(t, []byte{0xde, 0xad}, data)
+			assert.Equal(t, "01:02:03", startsAt)
+			assert.True(t, createdAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), "unexpected created_at %v", createdAt)
+		}
+	})
+
+	t.Run("should extract data types as copy blocks", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "100_data_types/001_tables.sql", "100_data_types/002_records.sql")
+		_, targetPool := NewPostgresContainer(ctx, t, "100_data_types/001_tables.sql")
+
+		_, err := pgPool.Exec(ctx, `
+			UPDATE cars SET maintenance_time = '08:30:00.123456', car_image = '\xdeadbeef' WHERE id = 1;
+			UPDATE cars SET maintenance_time = '23:59:59.5' WHERE id = 2`)
+		if !assert.NoError(t, err, "failed to set sub-second times") {
+			return
+		}
+
+		table := parser.Table{Name: "persons", Schema: "public"}
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithFormat(parser.FormatCopy)))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		sql, err := p.ExtractGraph(ctx, table, IntPrimaryKey(1), IntPrimaryKey(2))
+		if !assert.NoError(t, err, "failed to extract graph") {
+			return
+		}
+		assert.Contains(t, sql, "\t08:30:00.123456\t")
+		assert.Contains(t, sql, "\t23:59:59.5\t")
+		if !assert.NoError(t, LoadCopyStatements(ctx, targetPool, sql), "failed to load copy statements") {
+			return
+		}
+
+		query := "SELECT string_agg(concat_ws('|', id, maintenance_time, price, features, encode(car_image, 'hex')), ',' ORDER BY id) FROM cars"
+		var expected, copied string
+		if assert.NoError(t, pgPool.QueryRow(ctx, query).Scan(&expected), "failed to query source cars") &&
+			assert.NoError(t, targetPool.QueryRow(ctx, query).Scan(&copied), "failed to query loaded cars") {
+			assert.Equal(t, expected, copied)
+		}
+
+		// Rows of a COPY block can't be skipped or updated nor split in batches
+		for _, opt := range []parser.ConfigOpt{parser.WithConflictMode(parser.ConflictDoNothing), parser.WithBatchSize(10)} {
+			p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithFormat(parser.FormatCopy), opt))
+			if assert.NoError(t, err, "failed to create parser") {
+				_, err = p.ExtractGraph(ctx, table, IntPrimaryKey(1))
+				assert.ErrorContains(t, err, "copy output can't be combined with a conflict mode or a batch size")
+			}
+		}
+	})
+
+	t.Run("should export records graph as json", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+		table := parser.Table{Name: "payments", Schema: "public"}
+		pk := parser.PrimaryKey{
+			Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+			Values:  []interface{}{1},
+		}
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(
+			parser.WithFollowChildren(false),
+			parser.WithFormat(parser.FormatNDJSON),
+		))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		out, err := p.ExtractGraph(ctx, table, pk)
+		if assert.NoError(t, err, "failed to extract graph") {
+			assert.Equal(t,
+				`{"kind":"record","table":"users","schema":"public","primary_key":{"id":1},"columns":{"id":1,"name":"John Doe"}}`+"\n"+
+					`{"kind":"record","table":"orders","schema":"public","primary_key":{"id":1},"columns":{"amount":99.99,"id":1,"user_id":1}}`+"\n"+
+					`{"kind":"record","table":"payments","schema":"public","primary_key":{"id":1},"columns":{"amount":99.99,"id":1,"order_id":1}}`+"\n"+
+					`{"kind":"edge","relationship":"orders_user_id_fkey","relation_type":"many-to-one","child":1,"parent":0,"child_columns":["user_id"],"parent_columns":["id"]}`+"\n"+
+					`{"kind":"edge","relationship":"payments_order_id_fkey","relation_type":"many-to-one","child":2,"parent":1,"child_columns":["order_id"],"parent_columns":["id"]}`+"\n",
+				out)
+		}
+	})
+
+	t.Run("should render schema diagram of included tables", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql")
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithExcludedTables([]string{"payments"})))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		diagram, err := p.GenerateSchemaDiagram(parser.FormatMermaid)
+		if assert.NoError(t, err, "failed to render diagram") {
+			assert.Contains(t, diagram, "public_users ||--o{ public_orders : \"user_id -> id\"\n")
+			assert.NotContains(t, diagram, "payments")
+		}
+	})
+
+	t.Run("should limit traversal depth", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+		cases := []struct {
+			name               string
+			opts               []parser.ConfigOpt
+			table              string
+			id                 int
+			expectedRecords    []string
+			expectedUnresolved []string
+		}{
+			{
+				name:            "child depth",
+				opts:            []parser.ConfigOpt{parser.WithMaxChildDepth(1)},
+				table:           "users",
+				id:              1,
+				expectedRecords: []string{"users:1", "orders:1", "orders:2"},
+			},
+			{
+				name:               "parent depth",
+				opts:               []parser.ConfigOpt{parser.WithMaxParentDepth(1), parser.WithFollowChildren(false)},
+				table:              "payments",
+				id:                 1,
+				expectedRecords:    []string{"orders:1", "payments:1"},
+				expectedUnresolved: []string{"orders:1"},
+			},
+			{
+				name:               "total depth",
+				opts:               []parser.ConfigOpt{parser.WithMaxDepth(1)},
+				table:              "orders",
+				id:                 1,
+				expectedRecords:    []string{"users:1", "orders:1", "payments:1"},
+				expectedUnresolved: nil,
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(c.opts...))
+				if !assert.NoError(t, err, "failed to create parser") {
+					return
+				}
+
+				records, err := p.BuildGraph(ctx, parser.Table{Name: c.table, Schema: "public"}, IntPrimaryKey(c.id))
+				if assert.NoError(t, err, "failed to build graph") {
+					assert.Equal(t, c.expectedRecords, DescribeRecords(records))
+
+					var unresolved []parser.Record
+					for _, ref := range p.UnresolvedParents {
+						unresolved = append(unresolved, ref.Record)
+					}
+					assert.Equal(t, c.expectedUnresolved, DescribeRecords(unresolved))
+				}
+			})
+		}
+	})
+
+	t.Run("should expand records again when a shorter path reaches them", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "015_shortest_path/001_tables.sql", "015_shortest_path/002_records.sql")
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithMaxDepth(3)))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		// The district is first reached through the office and region, three hops away where its plan
+		// is beyond the limit, then through the badge of the employee, two hops away
+		records, err := p.BuildGraph(ctx, parser.Table{Name: "employees", Schema: "public"}, IntPrimaryKey(1))
+		if assert.NoError(t, err, "failed to build graph") {
+			assert.ElementsMatch(t,
+				[]string{"employees:1", "offices:1", "regions:1", "districts:1", "plans:1", "badges:1"},
+				DescribeRecords(records))
+			assert.Empty(t, p.UnresolvedParents)
+		}
+	})
+
+	t.Run("should follow relationship rules", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+		follow, skip := true, false
+
+		cases := []struct {
+			name            string
+			opts            []parser.ConfigOpt
+			table           string
+			expectedRecords []string
+		}{
+			{
+				name:            "skip children by pattern",
+				opts:            []parser.ConfigOpt{parser.WithRelationshipRules([]parser.RelationshipRule{{Match: "payments.order_id -> orders", Children: &skip}})},
+				table:           "users",
+				expectedRecords: []string{"users:1", "orders:1", "orders:2"},
+			},
+			{
+				name: "skip parents by constraint name",
+				opts: []parser.ConfigOpt{
+					parser.WithFollowChildren(false),
+					parser.WithRelationshipRules([]parser.RelationshipRule{{Match: "orders_user_id_fkey", Parents: &skip}}),
+				},
+				table:           "payments",
+				expectedRecords: []string{"orders:1", "payments:1"},
+			},
+			{
+				name: "follow children disabled by default",
+				opts: []parser.ConfigOpt{
+					parser.WithFollowChildren(false),
+					parser.WithRelationshipRules([]parser.RelationshipRule{{Match: "orders -> users", Children: &follow}}),
+				},
+				table:           "users",
+				expectedRecords: []string{"users:1", "orders:1", "orders:2"},
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(c.opts...))
+				if !assert.NoError(t, err, "failed to create parser") {
+					return
+				}
+
+				records, err := p.BuildGraph(ctx, parser.Table{Name: c.table, Schema: "public"}, IntPrimaryKey(1))
+				if assert.NoError(t, err, "failed to build graph") {
+					assert.Equal(t, c.expectedRecords, DescribeRecords(records))
+				}
+			})
+		}
+
+		// Rules given to the parser directly are checked as well
+		_, err := parser.NewParser(pgPool, parser.NewParserConfig(
+			parser.WithRelationshipRules([]parser.RelationshipRule{{Match: "orders[ -> users", Children: &skip}}),
+		))
+		assert.ErrorContains(t, err, "invalid relationship rules: rule 1")
+	})
+
+	t.Run("should traverse virtual relationships", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "008_virtual_relationships/001_tables.sql", "008_virtual_relationships/002_records.sql")
+
+		virtual := parser.WithVirtualRelationships([]parser.VirtualRelationship{
+			{SourceTable: "comments", SourceColumns: []string{"post_id"}, TargetTable: "public.posts", TargetColumns: []string{"id"}},
+		})
+
+		_, err := parser.NewParser(pgPool, parser.NewParserConfig())
+		assert.ErrorIs(t, err, parser.ErrNoRelationshipsFound)
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(virtual))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		if assert.Len(t, p.Relationships, 1) {
+			assert.Equal(t, "comments_post_id_virtual", p.Relationships[0].Name)
+			assert.Equal(t, parser.ManyToOne, p.Relationships[0].RelationType)
+		}
+
+		records, err := p.BuildGraph(ctx, parser.Table{Name: "posts", Schema: "public"}, IntPrimaryKey(1))
+		if assert.NoError(t, err, "failed to build graph from parent") {
+			assert.Equal(t, []string{"posts:1", "comments:1", "comments:2"}, DescribeRecords(records))
+		}
+		p.Reset()
+
+		records, err = p.BuildGraph(ctx, parser.Table{Name: "comments", Schema: "public"}, IntPrimaryKey(3))
+		if assert.NoError(t, err, "failed to build graph from child") {
+			assert.Equal(t, []string{"posts:2", "comments:3"}, DescribeRecords(records))
+		}
+
+		_, err = parser.NewParser(pgPool, parser.NewParserConfig(parser.WithVirtualRelationships([]parser.VirtualRelationship{
+			{SourceTable: "comments", SourceColumns: []string{"article_id"}, TargetTable: "posts", TargetColumns: []string{"id"}},
+		})))
+		assert.ErrorContains(t, err, "column article_id not found in table public.comments")
+	})
+
+	t.Run("should traverse polymorphic relationships", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "009_polymorphic_relationships/001_tables.sql", "009_polymorphic_relationships/002_records.sql")
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithVirtualRelationships([]parser.VirtualRelationship{{
+			SourceTable:   "comments",
+			SourceColumns: []string{"commentable_id"},
+			TypeColumn:    "commentable_type",
+			Targets: []parser.PolymorphicTarget{
+				{Type: "Post", Table: "posts"},
+				{Type: "Photo", Table: "photos", Columns: []string{"id"}},
+			},
+		}})))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		if assert.Len(t, p.Relationships, 2) {
+			assert.Equal(t, "comments_commentable_type_polymorphic", p.Relationships[0].Name)
+			assert.Equal(t, "posts", p.Relationships[0].TargetTable.Name)
+			assert.Equal(t, "photos", p.Relationships[1].TargetTable.Name)
+		}
+
+		testCases := []struct {
+			name            string
+			table           string
+			id              int
+			expectedRecords []string
+		}{
+			{name: "Children of post", table: "posts", id: 1, expectedRecords: []string{"posts:1", "comments:1", "comments:4"}},
+			{name: "Children of photo", table: "photos", id: 1, expectedRecords: []string{"photos:1", "comments:2"}},
+			{name: "Parent of comment on photo", table: "comments", id: 2, expectedRecords: []string{"photos:1", "comments:2"}},
+			{name: "Parent of comment on post", table: "comments", id: 3, expectedRecords: []string{"posts:2", "comments:3"}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				defer p.Reset()
+
+				records, err := p.BuildGraph(ctx, parser.Table{Name: tc.table, Schema: "public"}, IntPrimaryKey(tc.id))
+				if assert.NoError(t, err, "failed to build graph") {
+					assert.Equal(t, tc.expectedRecords, DescribeRecords(records))
+				}
+			})
+		}
+	})
+
+	t.Run("should filter and limit child records", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "010_row_filters/001_tables.sql", "010_row_filters/002_records.sql")
+
+		describeTruncations := func(truncations []parser.Truncation) []string {
+			var out []string
+			for _, t := range truncations {
+				out = append(out, fmt.Sprintf("%s:%v:%s", t.Relationship.SourceTable.Name, t.ParentKey[0], t.Reason))
+			}
+			return out
+		}
+		filter := parser.WithRowFilters(map[string]string{"events": "kind <> 'debug'"})
+
+		cases := []struct {
+			name                string
+			opts                []parser.ConfigOpt
+			id                  int
+			expectedRecords     []string
+			expectedTruncations []string
+		}{
+			{
+				name:                "row filter",
+				opts:                []parser.ConfigOpt{filter},
+				id:                  1,
+				expectedRecords:     []string{"customers:1", "events:1", "events:3", "events:4"},
+				expectedTruncations: []string{"events:1:row filter"},
+			},
+			{
+				name: "limit with order",
+				opts: []parser.ConfigOpt{parser.WithRelationshipRules([]parser.RelationshipRule{
+					{Match: "events -> customers", Limit: 2, OrderBy: "created_at DESC"},
+				})},
+				id:                  1,
+				expectedRecords:     []string{"customers:1", "events:4", "events:3"},
+				expectedTruncations: []string{"events:1:limit"},
+			},
+			{
+				name: "row filter and limit",
+				opts: []parser.ConfigOpt{filter, parser.WithRelationshipRules([]parser.RelationshipRule{
+					{Match: "events -> customers", Limit: 2},
+				})},
+				id:                  1,
+				expectedRecords:     []string{"customers:1", "events:1", "events:3"},
+				expectedTruncations: []string{"events:1:row filter", "events:1:limit"},
+			},
+			{
+				name: "limit not reached",
+				opts: []parser.ConfigOpt{filter, parser.WithRelationshipRules([]parser.RelationshipRule{
+					{Match: "events -> customers", Limit: 2},
+				})},
+				id:              2,
+				expectedRecords: []string{"customers:2", "events:5"},
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(c.opts...))
+				if !assert.NoError(t, err, "failed to create parser") {
+					return
+				}
+
+				records, err := p.BuildGraph(ctx, parser.Table{Name: "customers", Schema: "public"}, IntPrimaryKey(c.id))
+				if assert.NoError(t, err, "failed to build graph") {
+					assert.Equal(t, c.expectedRecords, DescribeRecords(records))
+					assert.Equal(t, c.expectedTruncations, describeTruncations(p.Truncations))
+				}
+			})
+		}
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(filter))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+		sql, err := p.ExtractGraph(ctx, parser.Table{Name: "customers", Schema: "public"}, IntPrimaryKey(1))
+		if assert.NoError(t, err, "failed to extract graph") {
+			assert.True(t, strings.HasPrefix(sql, "-- rows of public.events truncated by row filter\n"), sql)
+		}
+	})
+
+	t.Run("should build graph of several entry records", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+		orders := parser.Table{Name: "orders", Schema: "public"}
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig())
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		t.Run("primary keys", func(t *testing.T) {
+			defer p.Reset()
+
+			records, err := p.BuildGraph(ctx, orders, IntPrimaryKey(1), IntPrimaryKey(3), IntPrimaryKey(1))
+			if assert.NoError(t, err, "failed to build graph") {
+				assert.Equal(t, []string{"users:1", "users:2", "orders:1", "orders:3", "payments:1", "payments:3"}, DescribeRecords(records))
+			}
+		})
+
+		t.Run("where predicate", func(t *testing.T) {
+			defer p.Reset()
+
+			pks, err := p.SelectEntryKeys(ctx, orders, "user_id = 2")
+			if !assert.NoError(t, err, "failed to select entry keys") {
+				return
+			}
+			records, err := p.BuildGraph(ctx, orders, pks...)
+			if assert.NoError(t, err, "failed to build graph") {
+				assert.Equal(t, []string{"users:2", "orders:3", "orders:6", "payments:3", "payments:6"}, DescribeRecords(records))
+			}
+		})
+
+		t.Run("query", func(t *testing.T) {
+			defer p.Reset()
+
+			pks, err := p.QueryEntryKeys(ctx, orders, "SELECT order_id AS id FROM payments WHERE amount > 200")
+			if !assert.NoError(t, err, "failed to query entry keys") {
+				return
+			}
+			records, err := p.BuildGraph(ctx, orders, pks...)
+			if assert.NoError(t, err, "failed to build graph") {
+				assert.Equal(t, []string{"users:3", "users:5", "orders:4", "orders:10", "payments:4", "payments:10"}, DescribeRecords(records))
+			}
+		})
+
+		_, err = p.BuildGraph(ctx, orders)
+		assert.ErrorIs(t, err, parser.ErrNoEntryRecords)
+	})
+
+	t.Run("should mask values consistently across tables", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+		table := parser.Table{Name: "payments", Schema: "public"}
+		pk := parser.PrimaryKey{
+			Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+			Values:  []interface{}{1},
+		}
+		idRule := parser.MaskingRule{Column: "users.id", Strategy: parser.MaskHash}
+		nameRule := parser.MaskingRule{Column: "public.users.name", Strategy: parser.MaskName}
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(
+			parser.WithFollowChildren(false),
+			parser.WithFormat(parser.FormatNDJSON),
+			parser.WithMaskingRules([]parser.MaskingRule{idRule, nameRule}),
+			parser.WithMaskingSalt("salt"),
+		))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		// orders.user_id is masked like the users.id it references, so the edge between them is kept
+		userID := idRule.Mask(int32(1), "salt")
+		out, err := p.ExtractGraph(ctx, table, pk)
+		if assert.NoError(t, err, "failed to extract graph") {
+			assert.Equal(t,
+				fmt.Sprintf(`{"kind":"record","table":"users","schema":"public","primary_key":{"id":%d},"columns":{"id":%d,"name":"%s"}}`, userID, userID, nameRule.Mask("John Doe", "salt"))+"\n"+
+					fmt.Sprintf(`{"kind":"record","table":"orders","schema":"public","primary_key":{"id":1},"columns":{"amount":99.99,"id":1,"user_id":%d}}`, userID)+"\n"+
+					`{"kind":"record","table":"payments","schema":"public","primary_key":{"id":1},"columns":{"amount":99.99,"id":1,"order_id":1}}`+"\n"+
+					`{"kind":"edge","relationship":"orders_user_id_fkey","relation_type":"many-to-one","child":1,"parent":0,"child_columns":["user_id"],"parent_columns":["id"]}`+"\n"+
+					`{"kind":"edge","relationship":"payments_order_id_fkey","relation_type":"many-to-one","child":2,"parent":1,"child_columns":["order_id"],"parent_columns":["id"]}`+"\n",
+				out)
+		}
+
+		_, err = parser.NewParser(pgPool, parser.NewParserConfig(parser.WithMaskingRules([]parser.MaskingRule{
+			{Column: "users.emial", Strategy: parser.MaskEmail},
+		})))
+		assert.ErrorContains(t, err, "column emial not found in table public.users")
+
+		// Masked values have to fit their column and values of unique columns have to stay unique
+		_, err = parser.NewParser(pgPool, parser.NewParserConfig(parser.WithMaskingRules([]parser.MaskingRule{
+			{Column: "orders.amount", Strategy: parser.MaskEmail},
+		})))
+		assert.ErrorContains(t, err, "email masking only applies to text columns, not numeric")
+		_, err = parser.NewParser(pgPool, parser.NewParserConfig(parser.WithMaskingRules([]parser.MaskingRule{
+			{Column: "users.id", Strategy: parser.MaskFixed, Value: "1"},
+		})))
+		assert.ErrorContains(t, err, "fixed masking can give different values of a unique column the same value")
+
+		t.Run("keys of different integer types", func(t *testing.T) {
+			_, pgPool := NewPostgresContainer(ctx, t, "016_masking/001_tables.sql", "016_masking/002_records.sql")
+			_, targetPool := NewPostgresContainer(ctx, t, "016_masking/001_tables.sql")
+
+			idRule := parser.MaskingRule{Column: "tenants.id", Strategy: parser.MaskHash}
+			p, err := parser.NewParser(pgPool, parser.NewParserConfig(
+				parser.WithFollowChildren(false),
+				parser.WithMaskingRules([]parser.MaskingRule{idRule}),
+				parser.WithMaskingSalt("salt"),
+			))
+			if !assert.NoError(t, err, "failed to create parser") {
+				return
+			}
+
+			// The bigint invitations.tenant_id is masked like the integer tenants.id it references
+			tenantID := idRule.Mask(int32(1), "salt")
+			out, err := p.ExtractGraph(ctx, parser.Table{Name: "invitations", Schema: "public"}, IntPrimaryKey(1))
+			if assert.NoError(t, err, "failed to extract graph") {
+				assert.Equal(t,
+					fmt.Sprintf("INSERT INTO public.tenants (id, name) VALUES (%d, 'Acme');\n", tenantID)+
+						fmt.Sprintf("INSERT INTO public.invitations (id, tenant_id, note) VALUES (1, %d, 'welcome');\n", tenantID),
+					out)
+				_, err = targetPool.Exec(ctx, out)
+				assert.NoError(t, err, "failed to load masked graph")
+			}
+		})
+
+		t.Run("rules not fitting their column", func(t *testing.T) {
+			_, pgPool := NewPostgresContainer(ctx, t, "016_masking/001_tables.sql", "016_masking/002_records.sql")
+
+			cases := []struct {
+				name     string
+				rule     parser.MaskingRule
+				expected string
+			}{
+				{
+					name:     "null of a primary key",
+					rule:     parser.MaskingRule{Column: "tenants.id", Strategy: parser.MaskNull},
+					expected: "null masking doesn't apply to primary key or NOT NULL columns",
+				},
+				{
+					name:     "null of a NOT NULL column",
+					rule:     parser.MaskingRule{Column: "members.login", Strategy: parser.MaskNull},
+					expected: "null masking doesn't apply to primary key or NOT NULL columns",
+				},
+				{
+					name: "null of a nullable column",
+					rule: parser.MaskingRule{Column: "members.nickname", Strategy: parser.MaskNull},
+				},
+				{
+					name:     "email longer than the column",
+					rule:     parser.MaskingRule{Column: "members.login", Strategy: parser.MaskEmail},
+					expected: "email masking writes up to 33 characters, more than the 16 of the column",
+				},
+				{
+					name:     "hash longer than the column",
+					rule:     parser.MaskingRule{Column: "members.login", Strategy: parser.MaskHash},
+					expected: "hash masking writes up to 64 characters, more than the 16 of the column",
+				},
+				{
+					name: "hash fitting the column",
+					rule: parser.MaskingRule{Column: "members.nickname", Strategy: parser.MaskHash},
+				},
+				{
+					name: "email fitting the column",
+					rule: parser.MaskingRule{Column: "members.nickname", Strategy: parser.MaskEmail},
+				},
+				{
+					name: "fixed column of a composite key",
+					rule: parser.MaskingRule{Column: "members.tenant_id", Strategy: parser.MaskFixed, Value: "1"},
+				},
+			}
+
+			for _, c := range cases {
+				_, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithMaskingRules([]parser.MaskingRule{c.rule})))
+				if c.expected == "" {
+					assert.NoError(t, err, "unexpected error for case %s", c.name)
+				} else {
+					assert.ErrorContains(t, err, c.expected, "unexpected error for case %s", c.name)
+				}
+			}
+		})
+	})
+
+	t.Run("should remap primary keys and the foreign keys referencing them", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+		_, targetPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql")
+
+		table := parser.Table{Name: "payments", Schema: "public"}
+		pk := parser.PrimaryKey{
+			Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+			Values:  []interface{}{1},
+		}
+
+		// Sequences are taken from the database the output is loaded into, where rows up to 100 exist
+		for _, seq := range []string{"users_id_seq", "orders_id_seq", "payments_id_seq"} {
+			_, err := targetPool.Exec(ctx, fmt.Sprintf("SELECT setval('%s', 100)", seq))
+			assert.NoError(t, err, "failed to set sequence")
+		}
+
+		cases := []struct {
+			name        string
+			opts        []parser.ConfigOpt
+			expectedSQL string
+		}{
+			{
+				name: "offset",
+				opts: []parser.ConfigOpt{parser.WithKeyRemap(parser.KeyRemapOffset), parser.WithKeyOffset(1000)},
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (1001, 'John Doe');\n" +
+					"INSERT INTO public.orders (id, user_id, amount) VALUES (1001, 1001, 99.99);\n" +
+					"INSERT INTO public.payments (id, order_id, amount) VALUES (1001, 1001, 99.99);\n",
+			},
+			{
+				name: "sequence",
+				opts: []parser.ConfigOpt{parser.WithKeyRemap(parser.KeyRemapSequence), parser.WithSequencePool(targetPool)},
+				expectedSQL: "INSERT INTO public.users (id, name) VALUES (101, 'John Doe');\n" +
+					"INSERT INTO public.orders (id, user_id, amount) VALUES (101, 101, 99.99);\n" +
+					"INSERT INTO public.payments (id, order_id, amount) VALUES (101, 101, 99.99);\n",
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(append(c.opts, parser.WithFollowChildren(false))...))
+				if !assert.NoError(t, err, "failed to create parser") {
+					return
+				}
+
+				sql, err := p.ExtractGraph(ctx, table, pk)
+				if assert.NoError(t, err, "failed to extract graph") {
+					assert.Equal(t, c.expectedSQL, sql)
+				}
+			})
+		}
+
+		// Sequences of the source database are never advanced
+		var called bool
+		err := pgPool.QueryRow(ctx, "SELECT is_called FROM users_id_seq").Scan(&called)
+		if assert.NoError(t, err) {
+			assert.False(t, called)
+		}
+
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithKeyRemap(parser.KeyRemapSequence)))
+		if assert.NoError(t, err, "failed to create parser") {
+			_, err = p.ExtractGraph(ctx, table, pk)
+			assert.ErrorIs(t, err, parser.ErrNoSequencePool)
+		}
+	})
+
+	t.Run("should remap primary keys when copying records graph", func(t *testing.T) {
+		t.Run("sequence", func(t *testing.T) {
+			_, sourcePool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+			_, targetPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+			for _, seq := range []string{"users_id_seq", "orders_id_seq", "payments_id_seq"} {
+				_, err := targetPool.Exec(ctx, fmt.Sprintf("SELECT setval('%s', 100)", seq))
+				assert.NoError(t, err, "failed to set sequence")
+			}
+
+			p, err := parser.NewParser(sourcePool, parser.NewParserConfig(parser.WithKeyRemap(parser.KeyRemapSequence)))
+			if !assert.NoError(t, err, "failed to create parser") {
+				return
+			}
+
+			// The user, its two orders and their payments are copied next to the rows they were copied from
+			copied, err := p.CopyGraph(ctx, targetPool, parser.Table{Name: "users", Schema: "public"}, IntPrimaryKey(1))
+			if !assert.NoError(t, err, "failed to copy graph") {
+				return
+			}
+			assert.Equal(t, 5, copied)
+
+			var orders, payments int
+			err = targetPool.QueryRow(ctx, `SELECT
+				(SELECT count(*) FROM orders WHERE user_id = 101),
+				(SELECT count(*) FROM payments p JOIN orders o ON o.id = p.order_id WHERE o.user_id = 101 AND o.id > 100)`).Scan(&orders, &payments)
+			if assert.NoError(t, err) {
+				assert.Equal(t, 2, orders)
+				assert.Equal(t, 2, payments)
+			}
+		})
+
+		t.Run("uuid", func(t *testing.T) {
+			_, sourcePool := NewPostgresContainer(ctx, t, "013_uuid_keys/001_tables.sql", "013_uuid_keys/002_records.sql")
+			_, targetPool := NewPostgresContainer(ctx, t, "013_uuid_keys/001_tables.sql", "013_uuid_keys/002_records.sql")
+
+			p, err := parser.NewParser(sourcePool, parser.NewParserConfig(parser.WithKeyRemap(parser.KeyRemapUUID)))
+			if !assert.NoError(t, err, "failed to create parser") {
+				return
+			}
+
+			pk := parser.PrimaryKey{
+				Columns: []parser.Column{{Name: "id", DataType: "uuid", IsPrimary: true}},
+				Values:  []interface{}{"00000000-0000-0000-0000-000000000001"},
+			}
+			copied, err := p.CopyGraph(ctx, targetPool, parser.Table{Name: "documents", Schema: "public"}, pk)
+			if !assert.NoError(t, err, "failed to copy graph") {
+				return
+			}
+			assert.Equal(t, 3, copied)
+
+			// The copy has fresh keys and its revisions reference it rather than the original
+			var documents, revisions int
+			err = targetPool.QueryRow(ctx, `SELECT
+				(SELECT count(*) FROM documents),
+				(SELECT count(*) FROM revisions r JOIN documents d ON d.id = r.document_id
+					WHERE d.id <> '00000000-0000-0000-0000-000000000001' AND r.id::text NOT LIKE '00000000-%')`).Scan(&documents, &revisions)
+			if assert.NoError(t, err) {
+				assert.Equal(t, 2, documents)
+				assert.Equal(t, 2, revisions)
+			}
+		})
+	})
+
+	t.Run("should stream records graph", func(t *testing.T) {
+		t.Run("same statements as extracted graph", func(t *testing.T) {
+			_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+			table := parser.Table{Name: "users", Schema: "public"}
+			pk := parser.PrimaryKey{
+				Columns: []parser.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+				Values:  []interface{}{1},
+			}
+
+			p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithBatchSize(10)))
+			if !assert.NoError(t, err, "failed to create parser") {
+				return
+			}
+
+			expected, err := p.ExtractGraph(ctx, table, pk)
+			if !assert.NoError(t, err, "failed to extract graph") {
+				return
+			}
+
+			var sb strings.Builder
+			written, err := p.StreamGraph(ctx, &sb, table, pk)
+			if assert.NoError(t, err, "failed to stream graph") {
+				assert.Equal(t, 5, written)
+				assert.Equal(t, expected, sb.String())
+			}
+		})
+
+		t.Run("foreign keys of cycles restored at the end", func(t *testing.T) {
+			_, pgPool := NewPostgresContainer(ctx, t, "004_circular_loop/001_tables.sql", "004_circular_loop/002_records.sql")
+
+			table := parser.Table{Name: "users", Schema: "example"}
+
+			p, err := parser.NewParser(pgPool, parser.NewParserConfig(
+				parser.WithSchemas([]string{"example"}),
+				parser.WithFollowChildren(false),
+			))
+			if !assert.NoError(t, err, "failed to create parser") {
+				return
+			}
+
+			var sb strings.Builder
+			_, err = p.StreamGraph(ctx, &sb, table, IntPrimaryKey(1))
+			if assert.NoError(t, err, "failed to stream graph") {
+				assert.Equal(t,
+					"INSERT INTO example.departments (department_id, name, manager_id) VALUES (1, 'Engineering', NULL);\n"+
+						"INSERT INTO example.users (user_id, username, department_id) VALUES (1, 'jsmith', 1);\n"+
+						"UPDATE example.departments SET manager_id = 1 WHERE department_id = 1 AND manager_id IS NULL;\n",
+					sb.String())
+			}
+		})
+
+		t.Run("entry keys of any integer type", func(t *testing.T) {
+			_, pgPool := NewPostgresContainer(ctx, t, "004_circular_loop/001_tables.sql", "004_circular_loop/002_records.sql")
+
+			table := parser.Table{Name: "users", Schema: "example"}
+
+			p, err := parser.NewParser(pgPool, parser.NewParserConfig(
+				parser.WithSchemas([]string{"example"}),
+				parser.WithFollowChildren(false),
+			))
+			if !assert.NoError(t, err, "failed to create parser") {
+				return
+			}
+
+			// The entry user is visited once, so it isn't collected again as the manager of its department
+			var expected strings.Builder
+			if _, err := p.StreamGraph(ctx, &expected, table, IntPrimaryKey(1)); !assert.NoError(t, err, "failed to stream graph") {
+				return
+			}
+			for _, id := range []interface{}{int32(1), int64(1)} {
+				pk := parser.PrimaryKey{
+					Columns: []parser.Column{{Name: "user_id", DataType: "integer", IsPrimary: true}},
+					Values:  []interface{}{id},
+				}
+				var sb strings.Builder
+				written, err := p.StreamGraph(ctx, &sb, table, pk)
+				if assert.NoError(t, err, "failed to stream graph") {
+					assert.Equal(t, 2, written, "unexpected records for key of type %T", id)
+					assert.Equal(t, expected.String(), sb.String(), "unexpected output for key of type %T", id)
+				}
+			}
+		})
+
+		t.Run("foreign keys to unique keys other than the primary key", func(t *testing.T) {
+			_, pgPool := NewPostgresContainer(ctx, t, "014_unique_key_references/001_tables.sql", "014_unique_key_references/002_records.sql")
+			_, targetPool := NewPostgresContainer(ctx, t, "014_unique_key_references/001_tables.sql")
+
+			table := parser.Table{Name: "invoices", Schema: "public"}
+			newParser := func(format parser.OutputFormat) *parser.Parser {
+				p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithFormat(format)))
+				if !assert.NoError(t, err, "failed to create parser") {
+					t.FailNow()
+				}
+				return p
+			}
+
+			// The account is written first, its reference to the invoice is restored once the invoice is
+			var sb strings.Builder
+			written, err := newParser(parser.FormatSQL).StreamGraph(ctx, &sb, table, IntPrimaryKey(1))
+			if !assert.NoError(t, err, "failed to stream graph") {
+				return
+			}
+			assert.Equal(t, 3, written)
+			assert.Contains(t, sb.String(), "UPDATE public.accounts SET main_invoice_number = 'INV-1' WHERE id = 1 AND main_invoice_number IS NULL;\n")
+
+			_, err = targetPool.Exec(ctx, sb.String())
+			if assert.NoError(t, err, "failed to load streamed graph") {
+				var invoices int
+				var mainInvoice string
+				err = targetPool.QueryRow(ctx, `SELECT
+					(SELECT count(*) FROM invoices WHERE account_code = 'ACME'),
+					(SELECT main_invoice_number FROM accounts WHERE code = 'ACME')`).Scan(&invoices, &mainInvoice)
+				if assert.NoError(t, err) {
+					assert.Equal(t, 2, invoices)
+					assert.Equal(t, "INV-1", mainInvoice)
+				}
+			}
+
+			sb.Reset()
+			_, err = newParser(parser.FormatNDJSON).StreamGraph(ctx, &sb, table, IntPrimaryKey(1))
+			if assert.NoError(t, err, "failed to stream graph") {
+				// Both invoices reference the account and the account references its main invoice
+				assert.Equal(t, 3, strings.Count(sb.String(), `"kind":"edge"`))
+				assert.Contains(t, sb.String(), `"child_columns":["main_invoice_number"],"parent_columns":["number"]}`)
+			}
+		})
+	})
+
+	t.Run("should build the same graph concurrently", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "011_synthetic_graph/001_tables.sql")
+
+		// Items reference both an order and a product, so that the parents of a level are looked up
+		// through several relationships at once
+		_, err := pgPool.Exec(ctx, `
+			INSERT INTO customers (name) VALUES ('customer 1'), ('customer 2');
+			INSERT INTO products (name) SELECT 'product ' || i FROM generate_series(1, 20) AS i;
+			INSERT INTO orders (customer_id) SELECT 1 + i % 2 FROM generate_series(1, 40) AS i;
+			INSERT INTO order_items (order_id, product_id) SELECT o.id, (o.id * 3 + k) % 20 + 1 FROM orders AS o, generate_series(1, 3) AS k;`)
+		if !assert.NoError(t, err, "failed to seed synthetic graph") {
+			return
+		}
+
+		table := parser.Table{Name: "customers", Schema: "public"}
+		pks := []parser.PrimaryKey{IntPrimaryKey(2), IntPrimaryKey(1)}
+
+		expected := DescribeGraph(ctx, t, pgPool, table, pks, parser.WithConcurrency(1))
+		assert.Len(t, expected, 2+40+120+20)
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, expected, DescribeGraph(ctx, t, pgPool, table, pks, parser.WithConcurrency(8)),
+				"graph built concurrently differs, attempt %d", i+1)
+		}
+	})
+
+	t.Run("should build the same graph from a consistent snapshot", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "004_circular_loop/001_tables.sql", "004_circular_loop/002_records.sql")
+
+		table := parser.Table{Name: "departments", Schema: "example"}
+		pks := []parser.PrimaryKey{{
+			Columns: []parser.Column{{Name: "department_id", DataType: "integer", IsPrimary: true}},
+			Values:  []interface{}{1},
+		}}
+		schemas := parser.WithSchemas([]string{"example"})
+
+		expected := DescribeGraph(ctx, t, pgPool, table, pks, schemas)
+		assert.NotEmpty(t, expected)
+		assert.Equal(t, expected, DescribeGraph(ctx, t, pgPool, table, pks, schemas, parser.WithConsistentSnapshot(true)))
+		assert.Equal(t, expected, DescribeGraph(ctx, t, pgPool, table, pks, schemas, parser.WithConsistentSnapshot(true), parser.WithConcurrency(4)))
+
+		// Transactions of the snapshot are ended with the traversal
+		var open int
+		err := pgPool.QueryRow(ctx, "SELECT count(*) FROM pg_stat_activity WHERE state LIKE 'idle in transaction%'").Scan(&open)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, open)
+
+		// No connection would be left for the queries outside of the snapshot
+		config := pgPool.Config()
+		config.MaxConns = 1
+		singlePool, err := pgxpool.NewWithConfig(ctx, config)
+		if !assert.NoError(t, err, "failed to create pool") {
+			return
+		}
+		defer singlePool.Close()
+		p, err := parser.NewParser(singlePool, parser.NewParserConfig(schemas, parser.WithConsistentSnapshot(true)))
+		if assert.NoError(t, err, "failed to create parser") {
+			_, err = p.BuildGraph(ctx, table, pks...)
+			assert.ErrorContains(t, err, "a consistent snapshot needs a pool of at least 2 connections")
+		}
+	})
+
+	t.Run("should select entry records and build graph from the same snapshot", func(t *testing.T) {
+		_, pgPool := NewPostgresContainer(ctx, t, "001_one_to_one/001_tables.sql", "001_one_to_one/002_records.sql")
+
+		users := parser.Table{Name: "users", Schema: "public"}
+		p, err := parser.NewParser(pgPool, parser.NewParserConfig(parser.WithConsistentSnapshot(true)))
+		if !assert.NoError(t, err, "failed to create parser") {
+			return
+		}
+
+		if !assert.NoError(t, p.BeginSnapshot(ctx), "failed to begin snapshot") {
+			return
+		}
+		// Rows inserted from another connection once the snapshot is taken aren't part of it
+		_, err = pgPool.Exec(ctx, `INSERT INTO users (id, name) VALUES (6, 'Eve Adams');
+			INSERT INTO orders (id, user_id, amount) VALUES (100, 1, 10.00);`)
+		if !assert.NoError(t, err, "failed to insert records") {
+			p.EndSnapshot(ctx)
+			return
+		}
+
+		pks, err := p.SelectEntryKeys(ctx, users, "id IN (1, 6)")
+		if assert.NoError(t, err, "failed to select entry records") {
+			assert.Len(t, pks, 1)
+		}
+		records, err := p.BuildGraph(ctx, users, pks...)
+		p.EndSnapshot(ctx)
+		if assert.NoError(t, err, "failed to build graph") {
+			assert.Equal(t, []string{"users:1", "orders:1", "orders:2", "payments:1", "payments:2"}, DescribeRecords(records))
+		}
+
+		// The snapshot of a later traversal reads the inserted rows
+		p.Reset()
+		records, err = p.BuildGraph(ctx, users, IntPrimaryKey(1))
+		if assert.NoError(t, err, "failed to build graph") {
+			assert.Contains(t, DescribeRecords(records), "orders:100")
+		}
+	})
 }